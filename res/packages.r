@@ -1,3 +1,3 @@
 # This script is used to install the needed packages into the R environment
 install.packages("prophet")
-install.packages("argparser")
\ No newline at end of file
+install.packages("jsonlite")
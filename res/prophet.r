@@ -1,111 +1,176 @@
 #!/usr/bin/env Rscript
-library(argparser, quietly=TRUE)
+# This script calculates a water usage forecast with a prophet-based model. The
+# request document is read from stdin and the response document is written to
+# stdout. Both documents follow the protocol described in src/forecast/protocol.go
 library(prophet, quietly=TRUE)
 
-# Create a new argparser
-
-p <- arg_parser("Run a new forecast with a prophet-based model")
-
-# Add cli arguments
-p <- add_argument(p, "requestID", help="The request id prepended to all input and output files", type="character")
-p <- add_argument(p, "folder", help="The base folder in which the data files are located", type="character")
-# Parse the cli parameters
-argv <- parse_args(p)
-
-# Build the required files
-waterUsagesFile <- paste(argv$folder, "/water_usage_", argv$requestID, ".json", sep="")
-currentPopulationFile <- paste(argv$folder, "/current_population_", argv$requestID, ".json", sep="")
-lowPopulationMigrationFile <- paste(argv$folder, "/low_population_migration_", argv$requestID, ".json", sep="")
-mediumPopulationMigrationFile <- paste(argv$folder, "/medium_population_migration_", argv$requestID, ".json", sep="")
-highPopulationMigrationFile <- paste(argv$folder, "/high_population_migration_", argv$requestID, ".json", sep="")
-lowMigrationResultFile <- paste(argv$folder, "/result_low_migration_", argv$requestID, ".json", sep="")
-mediumMigrationResultFile <- paste(argv$folder, "/result_medium_migration_", argv$requestID, ".json", sep="")
-highMigrationResultFile <- paste(argv$folder, "/result_high_migration_", argv$requestID, ".json", sep="")
-
-# Read the file contents
-realWaterUsages <- jsonlite::read_json(waterUsagesFile, simplifyVector = TRUE)
-currentPopulation <- jsonlite::read_json(currentPopulationFile, simplifyVector = TRUE)
-lowPopulationMigration <- jsonlite::read_json(lowPopulationMigrationFile, simplifyVector = TRUE)
-mediumPopulationMigration <- jsonlite::read_json(mediumPopulationMigrationFile, simplifyVector = TRUE)
-highPopulationMigration <- jsonlite::read_json(highPopulationMigrationFile, simplifyVector = TRUE)
-
-# Start building the prophet model
-model <- prophet(interval.width = 0.5, weekly.seasonality = FALSE, daily.seasonality = FALSE, yearly.seasonality = TRUE)
-modelWaterUsages <- fit.prophet(model, realWaterUsages)
-futureDs <- prophet::make_future_dataframe(modelWaterUsages, 43, freq="year")
-# Forecast the water usage values
-forecastedWaterUsagesFull <- predict(modelWaterUsages, futureDs)
-forecastedWaterUsagesFull <- forecastedWaterUsagesFull[-1, ]
-forecastedWaterUsages <- forecastedWaterUsagesFull[c('ds', 'yhat', 'yhat_lower', 'yhat_upper')]
-lowerBoundWaterUsages <- forecastedWaterUsagesFull[c('ds', 'yhat_lower')]
-predictedWaterUsages <- forecastedWaterUsagesFull[c('ds', 'yhat')]
-upperBoundWaterUsages <- forecastedWaterUsagesFull[c('ds', 'yhat_upper')]
-
-# Merge the current and forecasted population values
-lowPopulationMigration <- rbind(currentPopulation, lowPopulationMigration)
-mediumPopulationMigration <- rbind(currentPopulation, mediumPopulationMigration)
-highPopulationMigration <- rbind(currentPopulation, highPopulationMigration)
-
-
-
-# Calculate the per-person usages for the low population migration data
-lowerBoundLowMigrationUsages <- lowPopulationMigration
-lowerBoundLowMigrationUsages$y <- NULL
-lowerBoundLowMigrationUsages$values <- lowerBoundWaterUsages$yhat_lower / lowPopulationMigration$y
-
-forecastedLowMigrationUsages <- lowPopulationMigration
-forecastedLowMigrationUsages$y <- NULL
-forecastedLowMigrationUsages$values <- predictedWaterUsages$yhat / lowPopulationMigration$y
-
-upperBoundLowMigrationUsages <- lowPopulationMigration
-upperBoundLowMigrationUsages$y <- NULL
-upperBoundLowMigrationUsages$values <- upperBoundWaterUsages$yhat_upper / lowPopulationMigration$y
-
-# Calculate the per-person usages for the medium population migration data
-lowerBoundMediumMigrationUsages <- mediumPopulationMigration
-lowerBoundMediumMigrationUsages$y <- NULL
-lowerBoundMediumMigrationUsages$values <- lowerBoundWaterUsages$yhat_lower / mediumPopulationMigration$y
-
-forecastedMediumMigrationUsages <- mediumPopulationMigration
-forecastedMediumMigrationUsages$y <- NULL
-forecastedMediumMigrationUsages$values <- predictedWaterUsages$yhat / mediumPopulationMigration$y
-
-upperBoundMediumMigrationUsages <- mediumPopulationMigration
-upperBoundMediumMigrationUsages$y <- NULL
-upperBoundMediumMigrationUsages$values <- upperBoundWaterUsages$yhat_upper / mediumPopulationMigration$y
-
-# Calculate the per-person usages for the high population migration data
-lowerBoundHighMigrationUsages <- highPopulationMigration
-lowerBoundHighMigrationUsages$y <- NULL
-lowerBoundHighMigrationUsages$values <- lowerBoundWaterUsages$yhat_lower / highPopulationMigration$y
-
-forecastedHighMigrationUsages <- highPopulationMigration
-forecastedHighMigrationUsages$y <- NULL
-forecastedHighMigrationUsages$values <- predictedWaterUsages$yhat / highPopulationMigration$y
-
-upperBoundHighMigrationUsages <- highPopulationMigration
-upperBoundHighMigrationUsages$y <- NULL
-upperBoundHighMigrationUsages$values <- upperBoundWaterUsages$yhat_upper / highPopulationMigration$y
-
-# Migrate the data back into single dataframes
-lowMigrationPerPersonUsages <- lowerBoundLowMigrationUsages
-lowMigrationPerPersonUsages$values <- NULL
-lowMigrationPerPersonUsages$lower <- lowerBoundLowMigrationUsages$values
-lowMigrationPerPersonUsages$forecast <- forecastedLowMigrationUsages$values
-lowMigrationPerPersonUsages$upper <- upperBoundLowMigrationUsages$values
-
-mediumMigrationPerPersonUsages <- lowerBoundMediumMigrationUsages
-mediumMigrationPerPersonUsages$values <- NULL
-mediumMigrationPerPersonUsages$lower <- lowerBoundMediumMigrationUsages$values
-mediumMigrationPerPersonUsages$forecast <- forecastedMediumMigrationUsages$values
-mediumMigrationPerPersonUsages$upper <- upperBoundMediumMigrationUsages$values
-
-highMigrationPerPersonUsages <- lowerBoundHighMigrationUsages
-highMigrationPerPersonUsages$values <- NULL
-highMigrationPerPersonUsages$lower <- lowerBoundHighMigrationUsages$values
-highMigrationPerPersonUsages$forecast <- forecastedHighMigrationUsages$values
-highMigrationPerPersonUsages$upper <- upperBoundHighMigrationUsages$values
-
-jsonlite::write_json(lowMigrationPerPersonUsages, lowMigrationResultFile, digits = 10)
-jsonlite::write_json(mediumMigrationPerPersonUsages, mediumMigrationResultFile, digits = 10)
-jsonlite::write_json(highMigrationPerPersonUsages, highMigrationResultFile, digits = 10)
+protocolVersion <- 1
+
+# Redirect the regular output to stderr since stdout may only contain the
+# response document
+sink(stderr(), type="output")
+
+# Read the request document
+request <- jsonlite::fromJSON(paste(readLines(file("stdin"), warn=FALSE), collapse="\n"), simplifyVector = TRUE)
+if (request$version != protocolVersion) {
+  stop(paste("unsupported protocol version", request$version))
+}
+realWaterUsages <- request$waterUsages
+currentPopulation <- request$currentPopulation
+intervalWidths <- request$intervalWidths
+modelOptions <- request$modelOptions
+
+populationAsRegressor <- modelOptions$populationMode == "regressor"
+
+# addLimits adds the saturating limits to a data frame if the model uses
+# logistic growth
+addLimits <- function(frame) {
+  if (modelOptions$growth == "logistic") {
+    frame$cap <- modelOptions$cap
+    if (!is.null(modelOptions$floor)) {
+      frame$floor <- modelOptions$floor
+    }
+  }
+  frame
+}
+
+# Attach the recorded population to the water usages if the population is used
+# as regressor
+history <- addLimits(realWaterUsages)
+if (populationAsRegressor) {
+  history <- merge(history, data.frame(ds = currentPopulation$ds, population = currentPopulation$y), by = "ds")
+  if (nrow(history) != nrow(realWaterUsages)) {
+    stop(sprintf("no population recorded for %d water usage rows", nrow(realWaterUsages) - nrow(history)))
+  }
+}
+changepoints <- NULL
+if (length(modelOptions$changepoints) > 0) {
+  changepoints <- sprintf("%d-01-01", modelOptions$changepoints)
+}
+
+# Start building the prophet model. The interval of the model matches the first
+# requested interval width
+model <- prophet(growth = modelOptions$growth, changepoints = changepoints,
+                 changepoint.prior.scale = modelOptions$changepointPriorScale,
+                 yearly.seasonality = modelOptions$yearlySeasonality,
+                 weekly.seasonality = modelOptions$weeklySeasonality,
+                 daily.seasonality = modelOptions$dailySeasonality,
+                 interval.width = intervalWidths[1])
+if (populationAsRegressor) {
+  model <- add_regressor(model, "population")
+}
+modelWaterUsages <- fit.prophet(model, history)
+
+# forecastWaterUsages forecasts the water usage values for the dates of the
+# supplied data frame. The bounds of every requested interval width are
+# calculated from the predictive samples of the model. The bounds of the first
+# width are used as lower and upper bound of the forecast as well, so that they
+# always match the first interval
+forecastWaterUsages <- function(future) {
+  samples <- predictive_samples(modelWaterUsages, future)$yhat
+  intervalBounds <- lapply(intervalWidths, function(width) {
+    list(
+      lower = apply(samples, 1, quantile, probs = (1 - width) / 2),
+      upper = apply(samples, 1, quantile, probs = (1 + width) / 2)
+    )
+  })
+  names(intervalBounds) <- as.character(intervalWidths)
+  list(forecast = predict(modelWaterUsages, future), intervalBounds = intervalBounds)
+}
+
+# perPersonUsages divides the forecasted water usages by the population of the
+# same row
+perPersonUsages <- function(usages, population) {
+  dataPoints <- list()
+  for (i in seq_len(nrow(population))) {
+    intervals <- lapply(usages$intervalBounds, function(bounds) {
+      list(lower = bounds$lower[i] / population$y[i], upper = bounds$upper[i] / population$y[i])
+    })
+    dataPoints[[i]] <- list(
+      ds = population$ds[i],
+      lower = usages$intervalBounds[[1]]$lower[i] / population$y[i],
+      forecast = usages$forecast$yhat[i] / population$y[i],
+      upper = usages$intervalBounds[[1]]$upper[i] / population$y[i],
+      intervals = intervals
+    )
+  }
+  dataPoints
+}
+
+# effectNames contains the columns of a prediction which are returned as effects
+# next to the trend if they are part of the model
+effectNames <- c("yearly", "weekly", "daily", "population")
+
+# waterUsageComponents extracts the trend and the effects of the forecasted
+# water usages for the dates of the population
+waterUsageComponents <- function(usages, population) {
+  columns <- intersect(effectNames, names(usages$forecast))
+  components <- list()
+  for (i in seq_len(nrow(population))) {
+    component <- list(ds = population$ds[i], trend = usages$forecast$trend[i])
+    if (length(columns) > 0) {
+      component$effects <- as.list(usages$forecast[i, columns, drop = FALSE])
+    }
+    components[[i]] <- component
+  }
+  components
+}
+
+# selectRows selects the rows of the forecasted water usages
+selectRows <- function(usages, rows) {
+  list(
+    forecast = usages$forecast[rows, , drop = FALSE],
+    intervalBounds = lapply(usages$intervalBounds, function(bounds) {
+      list(lower = bounds$lower[rows], upper = bounds$upper[rows])
+    })
+  )
+}
+
+# Without the population as regressor a single forecast is shared by all
+# population scenarios. The forecast contains every date of the population
+# series since the water usage series may miss years (e.g., dropped outliers)
+if (!populationAsRegressor) {
+  sharedDs <- sort(unique(c(currentPopulation$ds, unlist(lapply(request$populationScenarios, function(p) p$ds)))))
+  sharedUsages <- forecastWaterUsages(addLimits(data.frame(ds = sharedDs)))
+}
+
+# Calculate the per-person usages for every population scenario
+scenarios <- list()
+components <- list()
+for (scenario in names(request$populationScenarios)) {
+  # Merge the current and forecasted population values
+  population <- rbind(currentPopulation, request$populationScenarios[[scenario]])
+  if (populationAsRegressor) {
+    # Every scenario drives a separate prediction of the model
+    future <- addLimits(data.frame(ds = population$ds, population = population$y))
+    usages <- forecastWaterUsages(future)
+  } else {
+    usages <- selectRows(sharedUsages, match(population$ds, sharedDs))
+  }
+  scenarios[[scenario]] <- perPersonUsages(usages, population)
+  if (isTRUE(request$includeComponents)) {
+    components[[scenario]] <- waterUsageComponents(usages, population)
+  }
+}
+response <- list(version = protocolVersion, scenarios = scenarios)
+if (isTRUE(request$includeComponents)) {
+  response$components <- components
+}
+
+# Compare the in-sample predictions of the model with the recorded water usages
+if (isTRUE(request$includeFitted)) {
+  fittedUsages <- forecastWaterUsages(history)
+  response$fitted <- lapply(seq_len(nrow(history)), function(i) {
+    list(
+      ds = history$ds[i],
+      actual = history$y[i],
+      fitted = fittedUsages$forecast$yhat[i],
+      lower = fittedUsages$intervalBounds[[1]]$lower[i],
+      upper = fittedUsages$intervalBounds[[1]]$upper[i]
+    )
+  })
+}
+
+# Write the response document
+sink(type="output")
+cat(jsonlite::toJSON(response, auto_unbox = TRUE, digits = 10))
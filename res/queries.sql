@@ -26,4 +26,106 @@ FROM population.prognosis
 WHERE municipal_key = ANY($1)
 AND migration_level = $2::migration_level
 GROUP BY year
-ORDER BY year;
\ No newline at end of file
+ORDER BY year;
+
+-- name: create-forecast-schema
+CREATE SCHEMA IF NOT EXISTS prophet_forecast;
+
+-- name: create-result-cache-table
+CREATE TABLE IF NOT EXISTS prophet_forecast.result_cache (
+    key        text PRIMARY KEY,
+    response   jsonb NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- name: get-cached-result
+-- The parameter $1 is the cache key and $2 the time to live of an entry
+SELECT response
+FROM prophet_forecast.result_cache
+WHERE key = $1
+AND created_at > now() - $2::interval;
+
+-- name: set-cached-result
+INSERT INTO prophet_forecast.result_cache (key, response, created_at)
+VALUES ($1, $2, now())
+ON CONFLICT (key) DO UPDATE SET response = excluded.response, created_at = excluded.created_at;
+
+-- name: delete-expired-cached-results
+DELETE FROM prophet_forecast.result_cache
+WHERE created_at <= now() - $1::interval;
+
+-- name: trim-result-cache
+-- The parameter $1 is the maximum number of entries kept in the cache
+DELETE FROM prophet_forecast.result_cache
+WHERE key IN (SELECT key FROM prophet_forecast.result_cache ORDER BY created_at DESC OFFSET $1);
+
+-- name: create-forecast-runs-table
+CREATE TABLE IF NOT EXISTS prophet_forecast.runs (
+    id                text PRIMARY KEY,
+    created_at        timestamptz NOT NULL DEFAULT now(),
+    requested_keys    text[] NOT NULL,
+    municipality_keys text[] NOT NULL,
+    model             text NOT NULL,
+    options           jsonb NOT NULL,
+    input             jsonb NOT NULL,
+    result            jsonb NOT NULL,
+    runtime           double precision NOT NULL,
+    cache_hit         boolean NOT NULL
+);
+
+-- name: insert-forecast-run
+-- The parameter $8 is the runtime of the forecast in seconds
+INSERT INTO prophet_forecast.runs
+    (id, requested_keys, municipality_keys, model, options, input, result, runtime, cache_hit)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: list-forecast-runs
+-- The parameter $1 is an array of shape keys which are matched as prefixes of the municipality keys. An empty or null
+-- array disables the filter. The parameters $2 and $3 restrict the creation time and may be null
+SELECT id, created_at, requested_keys, municipality_keys, model, runtime, cache_hit
+FROM prophet_forecast.runs
+WHERE (coalesce(cardinality($1::text[]), 0) = 0 OR EXISTS (
+    SELECT 1 FROM unnest(municipality_keys) AS municipality, unnest($1::text[]) AS prefix
+    WHERE left(municipality, length(prefix)) = prefix))
+AND ($2::timestamptz IS NULL OR created_at >= $2::timestamptz)
+AND ($3::timestamptz IS NULL OR created_at < $3::timestamptz)
+ORDER BY created_at DESC
+LIMIT $4;
+
+-- name: get-forecast-run
+SELECT id, created_at, requested_keys, municipality_keys, model, runtime, cache_hit, options, input, result
+FROM prophet_forecast.runs
+WHERE id = $1;
+
+-- name: get-migration-levels
+-- The parameter $1 will be an array of municipal keys. The migration levels are
+-- ordered by their declaration in the migration_level type
+SELECT migration_level::text
+FROM (SELECT DISTINCT migration_level
+      FROM population.prognosis
+      WHERE municipal_key = ANY($1)) AS levels
+ORDER BY migration_level;
+
+-- name: get-shape-names
+-- The parameter $1 will be an array of shape keys
+SELECT key, name
+FROM geodata.shapes
+WHERE key = ANY($1);
+
+-- name: get-water-usages-by-type
+-- The parameter $1 will be an array of municipal keys and $2 an array of usage
+-- types. Only the water usages of the usage types are summed up
+SELECT date_part('year'::text, date)::integer as date, sum(amount) as usage
+FROM water_usage.usages
+WHERE municipality = ANY($1)
+AND usage_type::text = ANY($2)
+GROUP BY date
+ORDER BY date;
+
+-- name: get-usage-types
+-- The parameter $1 is an array of municipal keys. An empty or null array lists
+-- the usage types of all municipalities
+SELECT DISTINCT usage_type::text AS usage_type
+FROM water_usage.usages
+WHERE coalesce(cardinality($1::text[]), 0) = 0 OR municipality = ANY($1)
+ORDER BY usage_type;
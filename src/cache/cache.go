@@ -0,0 +1,36 @@
+// Package cache contains the caches used to store calculated forecasts. The
+// forecasts are stored under a key which is derived from everything the
+// forecast has been calculated from. Therefore, a cached forecast is only
+// returned if the same forecast would have been calculated again
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"microservice/structs"
+)
+
+// Cache is implemented by every backend which is able to store forecasts
+type Cache interface {
+	// Get returns the forecast stored under the key. The boolean indicates if
+	// an unexpired forecast has been found
+	Get(ctx context.Context, key string) (*structs.ScenarioResponse, bool, error)
+
+	// Set stores the forecast under the key
+	Set(ctx context.Context, key string, response *structs.ScenarioResponse) error
+}
+
+// Key calculates the key for a forecast by hashing the JSON representation of
+// the supplied value. The value should contain everything which influences the
+// forecast
+func Key(value any) (string, error) {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"microservice/structs"
+)
+
+// MemoryCache stores the forecasts in the memory of the service. If the cache
+// contains the maximum number of entries, the least recently used entry is
+// evicted
+type MemoryCache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	usage      *list.List
+}
+
+// memoryEntry is a single forecast stored in the MemoryCache
+type memoryEntry struct {
+	key      string
+	response *structs.ScenarioResponse
+	storedAt time.Time
+}
+
+// NewMemoryCache creates a new cache which keeps the forecasts for the ttl and
+// stores at most maxEntries forecasts
+func NewMemoryCache(ttl time.Duration, maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		usage:      list.New(),
+	}
+}
+
+// Get returns the forecast stored under the key
+func (c *MemoryCache) Get(_ context.Context, key string) (*structs.ScenarioResponse, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if time.Since(entry.storedAt) > c.ttl {
+		c.usage.Remove(element)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.usage.MoveToFront(element)
+	return entry.response, true, nil
+}
+
+// Set stores the forecast under the key and evicts the least recently used
+// entries if the cache is full
+func (c *MemoryCache) Set(_ context.Context, key string, response *structs.ScenarioResponse) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		element.Value = &memoryEntry{key: key, response: response, storedAt: time.Now()}
+		c.usage.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.usage.PushFront(&memoryEntry{key: key, response: response, storedAt: time.Now()})
+	for c.usage.Len() > c.maxEntries {
+		oldest := c.usage.Back()
+		c.usage.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"microservice/structs"
+)
+
+// response returns a forecast which is identified by the model name
+func response(model string) *structs.ScenarioResponse {
+	return &structs.ScenarioResponse{Metadata: &structs.Metadata{Model: model}}
+}
+
+// age moves the time the entry has been stored into the past
+func age(c *MemoryCache, key string, duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry := c.entries[key].Value.(*memoryEntry)
+	entry.storedAt = entry.storedAt.Add(-duration)
+}
+
+func TestMemoryCacheExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(time.Hour, 8)
+	if err := cache.Set(ctx, "fresh", response("fresh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(ctx, "expired", response("expired")); err != nil {
+		t.Fatal(err)
+	}
+	age(cache, "fresh", 59*time.Minute)
+	age(cache, "expired", 61*time.Minute)
+
+	if cached, hit, _ := cache.Get(ctx, "fresh"); !hit || cached.Metadata.Model != "fresh" {
+		t.Errorf("entry within the ttl has not been returned")
+	}
+	if _, hit, _ := cache.Get(ctx, "expired"); hit {
+		t.Errorf("entry older than the ttl has been returned")
+	}
+	if _, stored := cache.entries["expired"]; stored {
+		t.Errorf("expired entry has not been removed")
+	}
+
+	// storing the forecast again renews the entry
+	if err := cache.Set(ctx, "expired", response("renewed")); err != nil {
+		t.Fatal(err)
+	}
+	if cached, hit, _ := cache.Get(ctx, "expired"); !hit || cached.Metadata.Model != "renewed" {
+		t.Errorf("renewed entry has not been returned")
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsedEntry(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache(time.Hour, 2)
+	for _, key := range []string{"first", "second", "third"} {
+		if err := cache.Set(ctx, key, response(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, hit, _ := cache.Get(ctx, "first"); hit {
+		t.Errorf("oldest entry has not been evicted")
+	}
+
+	// reading an entry marks it as used, so the other entry is evicted next
+	if _, hit, _ := cache.Get(ctx, "second"); !hit {
+		t.Fatalf("entry has been evicted although the cache is not full")
+	}
+	if err := cache.Set(ctx, "fourth", response("fourth")); err != nil {
+		t.Fatal(err)
+	}
+	for key, wantHit := range map[string]bool{"second": true, "third": false, "fourth": true} {
+		if _, hit, _ := cache.Get(ctx, key); hit != wantHit {
+			t.Errorf("entry %q found: %t, want %t", key, hit, wantHit)
+		}
+	}
+	if len(cache.entries) != 2 || cache.usage.Len() != 2 {
+		t.Errorf("cache contains %d entries, want 2", len(cache.entries))
+	}
+}
+
+func TestKeyDependsOnValue(t *testing.T) {
+	first, err := Key(map[string]int{"horizon": 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := Key(map[string]int{"horizon": 5})
+	other, _ := Key(map[string]int{"horizon": 6})
+	if first != second {
+		t.Errorf("equal values got the keys %s and %s", first, second)
+	}
+	if first == other {
+		t.Errorf("different values got the same key %s", first)
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qustavo/dotsql"
+
+	"microservice/structs"
+)
+
+// PostgresCache stores the forecasts in a table of the database. This allows
+// sharing the cache between multiple instances of the service
+type PostgresCache struct {
+	db         *sql.DB
+	queries    *dotsql.DotSql
+	ttl        time.Duration
+	maxEntries int
+}
+
+// NewPostgresCache creates the table used for caching if it does not exist yet
+// and returns a cache which keeps the forecasts for the ttl and stores at most
+// maxEntries forecasts
+func NewPostgresCache(db *sql.DB, queries *dotsql.DotSql, ttl time.Duration, maxEntries int) (*PostgresCache, error) {
+	for _, query := range []string{"create-forecast-schema", "create-result-cache-table"} {
+		_, err := queries.Exec(db, query)
+		if err != nil {
+			return nil, fmt.Errorf("unable to prepare result cache table: %w", err)
+		}
+	}
+	return &PostgresCache{db: db, queries: queries, ttl: ttl, maxEntries: maxEntries}, nil
+}
+
+// Get returns the forecast stored under the key
+func (c *PostgresCache) Get(ctx context.Context, key string) (*structs.ScenarioResponse, bool, error) {
+	row, err := c.queries.QueryRowContext(ctx, c.db, "get-cached-result", key, c.interval())
+	if err != nil {
+		return nil, false, err
+	}
+	var content []byte
+	err = row.Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var response structs.ScenarioResponse
+	err = json.Unmarshal(content, &response)
+	if err != nil {
+		return nil, false, err
+	}
+	return &response, true, nil
+}
+
+// Set stores the forecast under the key and removes the expired entries and the
+// oldest entries exceeding the size limit afterwards
+func (c *PostgresCache) Set(ctx context.Context, key string, response *structs.ScenarioResponse) error {
+	content, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	_, err = c.queries.ExecContext(ctx, c.db, "set-cached-result", key, content)
+	if err != nil {
+		return err
+	}
+	_, err = c.queries.ExecContext(ctx, c.db, "delete-expired-cached-results", c.interval())
+	if err != nil {
+		return err
+	}
+	_, err = c.queries.ExecContext(ctx, c.db, "trim-result-cache", c.maxEntries)
+	return err
+}
+
+// interval returns the ttl of the cache as postgres interval
+func (c *PostgresCache) interval() string {
+	return fmt.Sprintf("%d seconds", int64(c.ttl.Seconds()))
+}
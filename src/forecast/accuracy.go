@@ -0,0 +1,58 @@
+package forecast
+
+import (
+	"math"
+
+	"microservice/structs"
+)
+
+// Comparison pairs a recorded value with the forecast of the same year
+type Comparison struct {
+	Actual   float64
+	Forecast structs.OutputDataPoint
+}
+
+// Accuracy calculates the accuracy metrics of the forecasts. Recorded values
+// of zero are left out of the mean absolute percentage error since their
+// percentage error is undefined. If no other values are recorded, the mean
+// absolute percentage error is not set
+func Accuracy(comparisons []Comparison) structs.AccuracyMetrics {
+	metrics := structs.AccuracyMetrics{
+		Observations: len(comparisons),
+		Coverage:     make(map[string]float64),
+	}
+	if len(comparisons) == 0 {
+		return metrics
+	}
+
+	var absoluteErrors, squaredErrors, percentageErrors float64
+	var percentageObservations int
+	for _, comparison := range comparisons {
+		forecastError := comparison.Actual - comparison.Forecast.Forecast
+		absoluteErrors += math.Abs(forecastError)
+		squaredErrors += forecastError * forecastError
+		if comparison.Actual != 0 {
+			percentageErrors += math.Abs(forecastError / comparison.Actual)
+			percentageObservations++
+		}
+		for name, band := range comparison.Forecast.Intervals {
+			covered := 0.0
+			if comparison.Actual >= band.LowerBound && comparison.Actual <= band.UpperBound {
+				covered = 1
+			}
+			metrics.Coverage[name] += covered
+		}
+	}
+
+	observations := float64(len(comparisons))
+	metrics.MeanAbsoluteError = absoluteErrors / observations
+	metrics.RootMeanSquaredError = math.Sqrt(squaredErrors / observations)
+	if percentageObservations > 0 {
+		meanPercentageError := 100 * percentageErrors / float64(percentageObservations)
+		metrics.MeanAbsolutePercentageError = &meanPercentageError
+	}
+	for name, covered := range metrics.Coverage {
+		metrics.Coverage[name] = covered / observations
+	}
+	return metrics
+}
@@ -0,0 +1,106 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+
+	"microservice/structs"
+)
+
+// comparison pairs the recorded value with a forecast whose interval of the
+// default width lies between the bounds
+func comparison(actual, forecast, lower, upper float64) Comparison {
+	return Comparison{
+		Actual: actual,
+		Forecast: structs.OutputDataPoint{
+			Forecast:  forecast,
+			Intervals: map[string]structs.Band{IntervalName(DefaultIntervalWidth): {LowerBound: lower, UpperBound: upper}},
+		},
+	}
+}
+
+func TestAccuracy(t *testing.T) {
+	tests := []struct {
+		name        string
+		comparisons []Comparison
+		mae, rmse   float64
+		// mape is negative if the percentage error is not set
+		mape     float64
+		coverage float64
+	}{
+		{
+			name:        "exact forecasts",
+			comparisons: []Comparison{comparison(100, 100, 90, 110), comparison(200, 200, 190, 210)},
+			coverage:    1,
+		},
+		{
+			// the errors are 10 and -30
+			name:        "known errors",
+			comparisons: []Comparison{comparison(100, 90, 80, 95), comparison(200, 230, 180, 240)},
+			mae:         20,
+			rmse:        math.Sqrt(500),
+			mape:        12.5,
+			coverage:    0.5,
+		},
+		{
+			name:        "bounds are covered",
+			comparisons: []Comparison{comparison(90, 100, 90, 110), comparison(110, 100, 90, 110)},
+			mae:         10,
+			rmse:        10,
+			mape:        100 * (10.0/90 + 10.0/110) / 2,
+			coverage:    1,
+		},
+		{
+			name:        "zero recorded values are left out of the percentage error",
+			comparisons: []Comparison{comparison(0, 10, -5, 5), comparison(100, 110, 90, 120)},
+			mae:         10,
+			rmse:        10,
+			mape:        10,
+			coverage:    1,
+		},
+		{
+			name:        "only zero recorded values",
+			comparisons: []Comparison{comparison(0, 10, 5, 15), comparison(0, -10, -15, 5)},
+			mae:         10,
+			rmse:        10,
+			mape:        -1,
+			coverage:    0.5,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics := Accuracy(test.comparisons)
+			if metrics.Observations != len(test.comparisons) {
+				t.Errorf("got %d observations, want %d", metrics.Observations, len(test.comparisons))
+			}
+			if math.Abs(metrics.MeanAbsoluteError-test.mae) > 1e-9 {
+				t.Errorf("got mae %f, want %f", metrics.MeanAbsoluteError, test.mae)
+			}
+			if math.Abs(metrics.RootMeanSquaredError-test.rmse) > 1e-9 {
+				t.Errorf("got rmse %f, want %f", metrics.RootMeanSquaredError, test.rmse)
+			}
+			switch {
+			case test.mape < 0 && metrics.MeanAbsolutePercentageError != nil:
+				t.Errorf("got mape %f, want none", *metrics.MeanAbsolutePercentageError)
+			case test.mape >= 0 && metrics.MeanAbsolutePercentageError == nil:
+				t.Errorf("got no mape, want %f", test.mape)
+			case test.mape >= 0 && math.Abs(*metrics.MeanAbsolutePercentageError-test.mape) > 1e-9:
+				t.Errorf("got mape %f, want %f", *metrics.MeanAbsolutePercentageError, test.mape)
+			}
+			coverage := metrics.Coverage[IntervalName(DefaultIntervalWidth)]
+			if math.Abs(coverage-test.coverage) > 1e-9 {
+				t.Errorf("got coverage %f, want %f", coverage, test.coverage)
+			}
+		})
+	}
+}
+
+func TestAccuracyWithoutComparisons(t *testing.T) {
+	metrics := Accuracy(nil)
+	if metrics.Observations != 0 || metrics.MeanAbsolutePercentageError != nil || len(metrics.Coverage) != 0 {
+		t.Errorf("got metrics %+v for no comparisons", metrics)
+	}
+	if math.IsNaN(metrics.MeanAbsoluteError) || math.IsNaN(metrics.RootMeanSquaredError) {
+		t.Errorf("got metrics %+v for no comparisons", metrics)
+	}
+}
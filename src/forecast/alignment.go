@@ -0,0 +1,261 @@
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"microservice/structs"
+)
+
+// The policies which are applied to gaps in the recorded data. Gaps are years
+// without a water usage or without a positive population. Interpolated gaps
+// are filled linearly between the neighbouring years, dropped gaps are removed
+// from the series and rejected gaps fail the forecast
+const (
+	GapInterpolate = "interpolate"
+	GapReject      = "reject"
+	GapDrop        = "drop"
+)
+
+// The codes of the warnings contained in a data quality report
+const (
+	WarningMissingWaterUsage = "MISSING_WATER_USAGE"
+	WarningMissingPopulation = "MISSING_POPULATION"
+	WarningZeroPopulation    = "ZERO_POPULATION"
+	WarningInterpolatedYears = "INTERPOLATED_YEARS"
+	WarningDroppedYears      = "DROPPED_YEARS"
+	WarningLowCoverage       = "LOW_COVERAGE"
+	WarningPrognosisGap      = "PROGNOSIS_GAP"
+)
+
+// ErrDataGaps is returned if the recorded data contains gaps which are rejected
+// by the gap policy
+var ErrDataGaps = errors.New("the recorded data contains gaps")
+
+// minimumCoverage is the share of the years of the water usages with a water
+// usage and a positive population below which a warning is added
+const minimumCoverage = 0.8
+
+// AlignSeries joins the water usages and the population by year and applies the
+// gap policy to the years of the water usages which miss a water usage or a
+// positive population. The population recorded after the water usages is
+// checked as well since it is used for the first forecast years. Water usages
+// recorded multiple times for a year are summed up. The returned series are
+// ordered by year and contain a data point per year at most
+func AlignSeries(waterUsages, population []structs.InputDataPoint, policy string) (
+	[]structs.InputDataPoint, []structs.InputDataPoint, *structs.DataQuality, error) {
+	usageByYear, err := valuesByYear(waterUsages, true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	populationByYear, err := valuesByYear(population, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	quality := &structs.DataQuality{GapPolicy: policy, Warnings: []structs.DataWarning{}}
+	if len(usageByYear) == 0 {
+		return nil, nil, quality, nil
+	}
+
+	firstYear, lastUsageYear := yearRange(usageByYear)
+	lastYear := lastUsageYear
+	if len(populationByYear) > 0 {
+		if _, lastPopulationYear := yearRange(populationByYear); lastPopulationYear > lastYear {
+			lastYear = lastPopulationYear
+		}
+	}
+
+	// now find the gaps. the population after the water usages is checked
+	// until the last recorded population
+	var missingUsages, missingPopulation, zeroPopulation []int
+	coveredYears := 0
+	for year := firstYear; year <= lastYear; year++ {
+		_, usageRecorded := usageByYear[year]
+		yearPopulation, populationRecorded := populationByYear[year]
+		if year <= lastUsageYear && !usageRecorded {
+			missingUsages = append(missingUsages, year)
+		}
+		switch {
+		case !populationRecorded:
+			missingPopulation = append(missingPopulation, year)
+		case yearPopulation <= 0:
+			zeroPopulation = append(zeroPopulation, year)
+		}
+		if year <= lastUsageYear && usageRecorded && populationRecorded && yearPopulation > 0 {
+			coveredYears++
+		}
+	}
+	quality.Coverage = float64(coveredYears) / float64(lastUsageYear-firstYear+1)
+
+	addWarning(quality, WarningMissingWaterUsage, "no water usage has been recorded", missingUsages)
+	addWarning(quality, WarningMissingPopulation, "no population has been recorded", missingPopulation)
+	addWarning(quality, WarningZeroPopulation, "the recorded population is not positive", zeroPopulation)
+	if quality.Coverage < minimumCoverage {
+		quality.Warnings = append(quality.Warnings, structs.DataWarning{
+			Code: WarningLowCoverage,
+			Message: fmt.Sprintf("only %.0f%% of the years contain a water usage and a positive population",
+				100*quality.Coverage),
+		})
+	}
+
+	populationGaps := append(append([]int{}, missingPopulation...), zeroPopulation...)
+	sort.Ints(populationGaps)
+	if policy == GapReject && (len(missingUsages) > 0 || len(populationGaps) > 0) {
+		return nil, nil, quality, fmt.Errorf("%w: %s", ErrDataGaps, describeGaps(missingUsages, populationGaps))
+	}
+
+	// the zero populations are handled like missing populations
+	for _, year := range zeroPopulation {
+		delete(populationByYear, year)
+	}
+
+	var interpolatedYears, droppedYears []int
+	if policy == GapInterpolate {
+		interpolatedYears = append(interpolatedYears, interpolateGaps(usageByYear, missingUsages)...)
+		interpolatedYears = append(interpolatedYears, interpolateGaps(populationByYear, populationGaps)...)
+	}
+
+	// now drop the water usages of the years which still miss a population.
+	// these are all years without a population if the gaps are not
+	// interpolated and the years before the first or after the last population
+	// otherwise
+	var alignedUsages []structs.InputDataPoint
+	for year := firstYear; year <= lastUsageYear; year++ {
+		usage, usageRecorded := usageByYear[year]
+		if !usageRecorded {
+			continue
+		}
+		if _, populationRecorded := populationByYear[year]; !populationRecorded {
+			droppedYears = append(droppedYears, year)
+			continue
+		}
+		alignedUsages = append(alignedUsages, structs.InputDataPoint{Date: yearDate(year), Value: usage})
+	}
+	var alignedPopulation []structs.InputDataPoint
+	for _, year := range sortedYears(populationByYear) {
+		alignedPopulation = append(alignedPopulation, structs.InputDataPoint{
+			Date:  yearDate(year),
+			Value: populationByYear[year],
+		})
+	}
+
+	sort.Ints(interpolatedYears)
+	addWarning(quality, WarningInterpolatedYears, "the gaps have been interpolated", uniqueYears(interpolatedYears))
+	addWarning(quality, WarningDroppedYears, "the water usages have been dropped since the population is missing",
+		droppedYears)
+	return alignedUsages, alignedPopulation, quality, nil
+}
+
+// AddPrognosisGapWarning adds a warning to the report if the population
+// prognosis does not start right after the recorded population. The years in
+// between are missing from the forecast
+func AddPrognosisGapWarning(quality *structs.DataQuality, lastPopulationYear, firstPrognosisYear int) {
+	var missingYears []int
+	for year := lastPopulationYear + 1; year < firstPrognosisYear; year++ {
+		missingYears = append(missingYears, year)
+	}
+	addWarning(quality, WarningPrognosisGap, "the population prognosis does not follow the recorded population",
+		missingYears)
+}
+
+// addWarning adds a warning listing the years to the report. If no years are
+// supplied, no warning is added
+func addWarning(quality *structs.DataQuality, code, message string, years []int) {
+	if len(years) == 0 {
+		return
+	}
+	quality.Warnings = append(quality.Warnings, structs.DataWarning{Code: code, Message: message, Years: years})
+}
+
+// valuesByYear maps the years of the data points to their values. If summed,
+// the values of data points in the same year are added up. Otherwise, the last
+// value of a year is used
+func valuesByYear(series []structs.InputDataPoint, summed bool) (map[int]float64, error) {
+	values := make(map[int]float64)
+	for _, dataPoint := range series {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the year of a data point: %w", err)
+		}
+		if summed {
+			values[year] += dataPoint.Value
+		} else {
+			values[year] = dataPoint.Value
+		}
+	}
+	return values, nil
+}
+
+// interpolateGaps fills the gap years which lie between two recorded years
+// linearly and returns the filled years. Gap years before the first or after
+// the last recorded year are not filled
+func interpolateGaps(values map[int]float64, gaps []int) []int {
+	years := sortedYears(values)
+	var filledYears []int
+	for _, gap := range gaps {
+		next := sort.SearchInts(years, gap)
+		if next == 0 || next == len(years) {
+			continue
+		}
+		previousYear, nextYear := years[next-1], years[next]
+		share := float64(gap-previousYear) / float64(nextYear-previousYear)
+		values[gap] = values[previousYear] + share*(values[nextYear]-values[previousYear])
+		filledYears = append(filledYears, gap)
+	}
+	return filledYears
+}
+
+// yearRange returns the first and the last year of the mapping
+func yearRange(values map[int]float64) (int, int) {
+	years := sortedYears(values)
+	return years[0], years[len(years)-1]
+}
+
+// sortedYears returns the years of the mapping in ascending order
+func sortedYears(values map[int]float64) []int {
+	years := make([]int, 0, len(values))
+	for year := range values {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	return years
+}
+
+// uniqueYears removes repeated years from the sorted years
+func uniqueYears(years []int) []int {
+	var unique []int
+	for i, year := range years {
+		if i == 0 || year != years[i-1] {
+			unique = append(unique, year)
+		}
+	}
+	return unique
+}
+
+// yearDate returns the date a yearly data point is stored with
+func yearDate(year int) string {
+	return fmt.Sprintf("%d-12-31", year)
+}
+
+// describeGaps lists the years of the gaps for an error message
+func describeGaps(missingUsages, populationGaps []int) string {
+	var descriptions []string
+	if len(missingUsages) > 0 {
+		descriptions = append(descriptions, fmt.Sprintf("no water usage in %s", joinYears(missingUsages)))
+	}
+	if len(populationGaps) > 0 {
+		descriptions = append(descriptions, fmt.Sprintf("no positive population in %s", joinYears(populationGaps)))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// joinYears joins the years with commas
+func joinYears(years []int) string {
+	formattedYears := make([]string, len(years))
+	for i, year := range years {
+		formattedYears[i] = fmt.Sprint(year)
+	}
+	return strings.Join(formattedYears, ", ")
+}
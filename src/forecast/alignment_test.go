@@ -0,0 +1,246 @@
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"microservice/structs"
+)
+
+// yearSeries builds a series containing the value for every year
+func yearSeries(values map[int]float64) []structs.InputDataPoint {
+	var series []structs.InputDataPoint
+	for _, year := range sortedYears(values) {
+		series = append(series, structs.InputDataPoint{Date: yearDate(year), Value: values[year]})
+	}
+	return series
+}
+
+// yearValues builds a mapping with the value for every year from the first
+// until the last year. The skipped years are left out
+func yearValues(firstYear, lastYear int, value float64, skippedYears ...int) map[int]float64 {
+	values := make(map[int]float64)
+	for year := firstYear; year <= lastYear; year++ {
+		values[year] = value
+	}
+	for _, year := range skippedYears {
+		delete(values, year)
+	}
+	return values
+}
+
+// seriesValues maps the years of the series to their values
+func seriesValues(t *testing.T, series []structs.InputDataPoint) map[int]float64 {
+	t.Helper()
+	values, err := valuesByYear(series, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+// withValue sets the value of the year
+func withValue(values map[int]float64, year int, value float64) map[int]float64 {
+	values[year] = value
+	return values
+}
+
+func TestAlignSeries(t *testing.T) {
+	tests := []struct {
+		name       string
+		usages     map[int]float64
+		population map[int]float64
+		policy     string
+		// wantUsages and wantPopulation contain the aligned series
+		wantUsages     map[int]float64
+		wantPopulation map[int]float64
+		// wantWarnings contains the years of every expected warning
+		wantWarnings map[string][]int
+		wantCoverage float64
+	}{
+		{
+			name:           "complete series",
+			usages:         yearValues(2011, 2015, 100),
+			population:     yearValues(2011, 2015, 10),
+			policy:         GapReject,
+			wantUsages:     yearValues(2011, 2015, 100),
+			wantPopulation: yearValues(2011, 2015, 10),
+			wantWarnings:   map[string][]int{},
+			wantCoverage:   1,
+		},
+		{
+			name:           "interior water usage gap interpolated",
+			usages:         withValue(yearValues(2011, 2015, 100, 2013), 2014, 140),
+			population:     yearValues(2011, 2015, 10),
+			policy:         GapInterpolate,
+			wantUsages:     withValue(withValue(yearValues(2011, 2015, 100), 2013, 120), 2014, 140),
+			wantPopulation: yearValues(2011, 2015, 10),
+			wantWarnings: map[string][]int{
+				WarningMissingWaterUsage: {2013},
+				WarningInterpolatedYears: {2013},
+			},
+			wantCoverage: 0.8,
+		},
+		{
+			name:           "interior water usage gap dropped",
+			usages:         yearValues(2011, 2015, 100, 2013),
+			population:     yearValues(2011, 2015, 10),
+			policy:         GapDrop,
+			wantUsages:     yearValues(2011, 2015, 100, 2013),
+			wantPopulation: yearValues(2011, 2015, 10),
+			wantWarnings:   map[string][]int{WarningMissingWaterUsage: {2013}},
+			wantCoverage:   0.8,
+		},
+		{
+			name:           "interior population gap interpolated",
+			usages:         yearValues(2011, 2015, 100),
+			population:     withValue(yearValues(2011, 2015, 10, 2012), 2013, 14),
+			policy:         GapInterpolate,
+			wantUsages:     yearValues(2011, 2015, 100),
+			wantPopulation: withValue(withValue(yearValues(2011, 2015, 10), 2012, 12), 2013, 14),
+			wantWarnings: map[string][]int{
+				WarningMissingPopulation: {2012},
+				WarningInterpolatedYears: {2012},
+			},
+			wantCoverage: 0.8,
+		},
+		{
+			name:           "interior population gap dropped",
+			usages:         yearValues(2011, 2015, 100),
+			population:     yearValues(2011, 2015, 10, 2012),
+			policy:         GapDrop,
+			wantUsages:     yearValues(2011, 2015, 100, 2012),
+			wantPopulation: yearValues(2011, 2015, 10, 2012),
+			wantWarnings: map[string][]int{
+				WarningMissingPopulation: {2012},
+				WarningDroppedYears:      {2012},
+			},
+			wantCoverage: 0.8,
+		},
+		{
+			name:           "leading and trailing population gaps",
+			usages:         yearValues(2011, 2016, 100),
+			population:     yearValues(2012, 2015, 10),
+			policy:         GapInterpolate,
+			wantUsages:     yearValues(2012, 2015, 100),
+			wantPopulation: yearValues(2012, 2015, 10),
+			wantWarnings: map[string][]int{
+				WarningMissingPopulation: {2011, 2016},
+				WarningDroppedYears:      {2011, 2016},
+				WarningLowCoverage:       nil,
+			},
+			wantCoverage: 4.0 / 6,
+		},
+		{
+			name:           "zero population interpolated",
+			usages:         yearValues(2011, 2015, 100),
+			population:     withValue(yearValues(2011, 2015, 10), 2013, 0),
+			policy:         GapInterpolate,
+			wantUsages:     yearValues(2011, 2015, 100),
+			wantPopulation: yearValues(2011, 2015, 10),
+			wantWarnings: map[string][]int{
+				WarningZeroPopulation:    {2013},
+				WarningInterpolatedYears: {2013},
+			},
+			wantCoverage: 0.8,
+		},
+		{
+			name:           "population only years",
+			usages:         yearValues(2011, 2015, 100),
+			population:     yearValues(2011, 2018, 10, 2017),
+			policy:         GapInterpolate,
+			wantUsages:     yearValues(2011, 2015, 100),
+			wantPopulation: yearValues(2011, 2018, 10),
+			wantWarnings: map[string][]int{
+				WarningMissingPopulation: {2017},
+				WarningInterpolatedYears: {2017},
+			},
+			wantCoverage: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			usages, population, quality, err := AlignSeries(yearSeries(test.usages), yearSeries(test.population),
+				test.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := seriesValues(t, usages); fmt.Sprint(got) != fmt.Sprint(test.wantUsages) {
+				t.Errorf("got water usages %v, want %v", got, test.wantUsages)
+			}
+			if got := seriesValues(t, population); fmt.Sprint(got) != fmt.Sprint(test.wantPopulation) {
+				t.Errorf("got population %v, want %v", got, test.wantPopulation)
+			}
+			if quality.GapPolicy != test.policy {
+				t.Errorf("report contains the gap policy %q, want %q", quality.GapPolicy, test.policy)
+			}
+			if math.Abs(quality.Coverage-test.wantCoverage) > 1e-9 {
+				t.Errorf("got coverage %f, want %f", quality.Coverage, test.wantCoverage)
+			}
+			warnings := make(map[string][]int)
+			for _, warning := range quality.Warnings {
+				warnings[warning.Code] = warning.Years
+			}
+			if fmt.Sprint(warnings) != fmt.Sprint(test.wantWarnings) {
+				t.Errorf("got warnings %v, want %v", warnings, test.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestAlignSeriesSumsRepeatedYears(t *testing.T) {
+	usages := append(yearSeries(yearValues(2011, 2013, 100)), structs.InputDataPoint{Date: "2012-12-31", Value: 50})
+	alignedUsages, _, _, err := AlignSeries(usages, yearSeries(yearValues(2011, 2013, 10)), GapReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]float64{2011: 100, 2012: 150, 2013: 100}
+	if got := seriesValues(t, alignedUsages); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got water usages %v, want %v", got, want)
+	}
+}
+
+func TestAlignSeriesRejectsGaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		usages     map[int]float64
+		population map[int]float64
+		message    string
+	}{
+		{"water usage gap", yearValues(2011, 2015, 100, 2013), yearValues(2011, 2015, 10),
+			"no water usage in 2013"},
+		{"population gaps", yearValues(2011, 2015, 100), withValue(yearValues(2012, 2015, 10), 2014, 0),
+			"no positive population in 2011, 2014"},
+		{"population gap after the water usages", yearValues(2011, 2013, 100), yearValues(2011, 2016, 10, 2015),
+			"no positive population in 2015"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, quality, err := AlignSeries(yearSeries(test.usages), yearSeries(test.population), GapReject)
+			if !errors.Is(err, ErrDataGaps) {
+				t.Fatalf("got error %v, want %v", err, ErrDataGaps)
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("error %q does not contain %q", err, test.message)
+			}
+			if quality == nil || len(quality.Warnings) == 0 {
+				t.Errorf("rejected gaps are missing from the report")
+			}
+		})
+	}
+}
+
+func TestAddPrognosisGapWarning(t *testing.T) {
+	quality := &structs.DataQuality{Warnings: []structs.DataWarning{}}
+	AddPrognosisGapWarning(quality, 2020, 2021)
+	if len(quality.Warnings) != 0 {
+		t.Errorf("warning added although the prognosis follows the recorded population")
+	}
+	AddPrognosisGapWarning(quality, 2020, 2023)
+	if !hasWarning(quality, WarningPrognosisGap, 2021) || !hasWarning(quality, WarningPrognosisGap, 2022) {
+		t.Errorf("got warnings %+v, want a prognosis gap in 2021 and 2022", quality.Warnings)
+	}
+}
@@ -0,0 +1,116 @@
+// Package forecast contains the model backends which are able to create a water
+// usage forecast from the data pulled from the database. Every backend
+// implements the Forecaster interface which allows the route handlers to
+// switch between the backends without knowing how the forecast is calculated
+package forecast
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"microservice/structs"
+)
+
+// ErrTooFewDataPoints is returned by a backend if the water usage series is
+// too short to fit the model
+var ErrTooFewDataPoints = errors.New("the water usage series contains too few data points to fit the model")
+
+// ErrSeriesLengthMismatch is returned by a backend if the population series do
+// not match the length of the forecast series
+var ErrSeriesLengthMismatch = errors.New("the population series do not match the length of the forecast")
+
+// ErrMissingDependency is returned by a backend if a dependency needed to run
+// the model is not installed
+var ErrMissingDependency = errors.New("a dependency of the model is not installed")
+
+// ErrModelFailed is returned by a backend if the model failed for a reason
+// which could not be classified
+var ErrModelFailed = errors.New("the model failed to calculate the forecast")
+
+// Input contains the time series a forecast is calculated from
+type Input struct {
+	// WaterUsages contains the recorded water usages of the selected areas
+	WaterUsages []structs.InputDataPoint `json:"waterUsages"`
+
+	// CurrentPopulation contains the recorded population of the selected areas
+	// starting with the first year of the water usage data
+	CurrentPopulation []structs.InputDataPoint `json:"currentPopulation"`
+
+	// PopulationScenarios contains the predicted population for every
+	// scenario that shall be forecast. The key of the mapping is the name of
+	// the scenario (e.g., the migration level)
+	PopulationScenarios map[string][]structs.InputDataPoint `json:"populationScenarios"`
+}
+
+// Options contains the settings which are used while calculating a forecast
+type Options struct {
+	// RequestID is the identifier of the request which triggered the forecast
+	RequestID string `json:"-"`
+
+	// Horizon is the number of years which are forecast after the last year
+	// of the water usage series. It is not sent to model processes since the
+	// population scenarios already end with the last forecast year
+	Horizon int `json:"horizon"`
+
+	// IntervalWidths contains the widths of the prediction intervals which
+	// are calculated. The bounds of the output data points belong to the first
+	// width. If no widths are set, DefaultIntervalWidth is used
+	IntervalWidths []float64 `json:"intervalWidths"`
+
+	// Model contains the options configuring the trend and the seasonality of
+	// the model. The options need to be valid (see ValidateModelOptions)
+	Model structs.ModelOptions `json:"model"`
+
+	// IncludeComponents requests the components of the total water usage for
+	// every population scenario
+	IncludeComponents bool `json:"includeComponents,omitempty"`
+
+	// IncludeFitted requests the total water usages fitted by the model for
+	// the years of the recorded water usages
+	IncludeFitted bool `json:"includeFitted,omitempty"`
+}
+
+// DefaultIntervalWidth is the width of the prediction interval which is used if
+// no widths have been requested
+const DefaultIntervalWidth = 0.5
+
+// intervalWidths returns the requested interval widths or the default width if
+// no widths have been requested
+func (o Options) intervalWidths() []float64 {
+	if len(o.IntervalWidths) == 0 {
+		return []float64{DefaultIntervalWidth}
+	}
+	return o.IntervalWidths
+}
+
+// IntervalName returns the name of the band with the supplied width which is
+// used as key in the intervals of an output data point
+func IntervalName(width float64) string {
+	return strconv.FormatFloat(width, 'f', -1, 64)
+}
+
+// Result contains the per-person water usage forecast for every population
+// scenario supplied in the Input
+type Result struct {
+	// Scenarios maps the name of a population scenario to its forecast
+	Scenarios map[string][]structs.OutputDataPoint
+
+	// Components maps the name of a population scenario to the components of
+	// the total water usage. The components are only set if they have been
+	// requested in the Options
+	Components map[string][]structs.ComponentPoint
+
+	// Fitted contains the total water usages fitted for the years of the
+	// recorded water usages. The values are only set if they have been
+	// requested in the Options
+	Fitted []structs.FittedPoint
+}
+
+// Forecaster is implemented by every model backend which is able to calculate
+// a water usage forecast
+type Forecaster interface {
+	// Forecast calculates the per-person water usage forecast for every
+	// population scenario contained in the input
+	Forecast(ctx context.Context, input Input, options Options) (*Result, error)
+}
@@ -0,0 +1,121 @@
+package forecast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrQueueFull is returned by a LimitedForecaster if the maximum number of
+// forecasts are already waiting for a free execution slot
+var ErrQueueFull = errors.New("too many forecasts are waiting for execution")
+
+// Limiter restricts the number of forecasts which are executed at the same time.
+// Forecasts which exceed the limit wait in a bounded queue until an execution
+// slot is released. The slots are handed to the waiting forecasts in the order
+// they have been queued, so new forecasts do not overtake queued ones
+type Limiter struct {
+	mutex       sync.Mutex
+	concurrency int
+	queueSize   int
+	running     int
+	// waiters contains a channel for every queued forecast which is closed
+	// once an execution slot has been handed to the forecast
+	waiters []chan struct{}
+	logger  zerolog.Logger
+}
+
+// NewLimiter creates a limiter which executes at most concurrency forecasts at
+// the same time while at most queueSize forecasts may wait for execution
+func NewLimiter(concurrency int, queueSize int, logger zerolog.Logger) *Limiter {
+	return &Limiter{
+		concurrency: concurrency,
+		queueSize:   queueSize,
+		logger:      logger,
+	}
+}
+
+// Acquire waits until an execution slot is available and returns a function
+// releasing the slot again. If the queue is full, ErrQueueFull is returned
+// right away. If the context is cancelled while waiting, the error of the
+// context is returned
+func (l *Limiter) Acquire(ctx context.Context, requestID string) (func(), error) {
+	l.mutex.Lock()
+	if l.running < l.concurrency && len(l.waiters) == 0 {
+		l.running++
+		l.mutex.Unlock()
+		return l.release, nil
+	}
+	if len(l.waiters) >= l.queueSize {
+		queueDepth := len(l.waiters)
+		l.mutex.Unlock()
+		l.logger.Warn().Str("requestID", requestID).Int("queueDepth", queueDepth).
+			Msg("rejected forecast since the queue is full")
+		return nil, ErrQueueFull
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	queueDepth := len(l.waiters)
+	l.mutex.Unlock()
+	l.logger.Info().Str("requestID", requestID).Int("queueDepth", queueDepth).Msg("waiting for execution slot")
+
+	waitStartTime := time.Now()
+	select {
+	case <-ready:
+		l.logger.Info().Str("requestID", requestID).Str("waitTime", time.Since(waitStartTime).String()).
+			Msg("acquired execution slot")
+		return l.release, nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		select {
+		case <-ready:
+			// the slot has been handed over while the context has been
+			// cancelled. it is passed on to the next forecast
+			l.mutex.Unlock()
+			l.release()
+		default:
+			for i, waiter := range l.waiters {
+				if waiter == ready {
+					l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+					break
+				}
+			}
+			l.mutex.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release hands the execution slot to the longest waiting forecast. If no
+// forecast is waiting, the slot is freed
+func (l *Limiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.waiters) == 0 {
+		l.running--
+		return
+	}
+	close(l.waiters[0])
+	l.waiters = l.waiters[1:]
+}
+
+// LimitedForecaster executes the wrapped Forecaster only after acquiring an
+// execution slot from the Limiter
+type LimitedForecaster struct {
+	Forecaster Forecaster
+	Limiter    *Limiter
+}
+
+// Forecast waits for an execution slot and calculates the forecast with the
+// wrapped Forecaster
+func (f LimitedForecaster) Forecast(ctx context.Context, input Input, options Options) (*Result, error) {
+	release, err := f.Limiter.Acquire(ctx, options.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return f.Forecaster.Forecast(ctx, input, options)
+}
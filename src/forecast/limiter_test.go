@@ -0,0 +1,158 @@
+package forecast
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// queueDepth returns the number of forecasts waiting for an execution slot
+func queueDepth(l *Limiter) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.waiters)
+}
+
+// waitForQueueDepth waits until the number of waiting forecasts matches
+func waitForQueueDepth(t *testing.T, l *Limiter, depth int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for queueDepth(l) != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d forecasts are waiting, want %d", queueDepth(l), depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// acquireInBackground acquires an execution slot in a separate goroutine. The
+// returned channel receives the result once the slot has been acquired
+func acquireInBackground(ctx context.Context, l *Limiter, requestID string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, requestID)
+		result <- err
+	}()
+	return result
+}
+
+func TestLimiterRejectsForecastsIfQueueIsFull(t *testing.T) {
+	limiter := NewLimiter(1, 1, zerolog.Nop())
+	release, err := limiter.Acquire(context.Background(), "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := acquireInBackground(context.Background(), limiter, "waiting")
+	waitForQueueDepth(t, limiter, 1)
+
+	if _, err := limiter.Acquire(context.Background(), "rejected"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got error %v, want %v", err, ErrQueueFull)
+	}
+
+	release()
+	if err := <-waiting; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimiterHandsSlotsToWaitingForecastsInOrder(t *testing.T) {
+	limiter := NewLimiter(1, 3, zerolog.Nop())
+	release, err := limiter.Acquire(context.Background(), "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan string, 3)
+	for depth, requestID := range []string{"first", "second", "third"} {
+		go func(requestID string) {
+			release, err := limiter.Acquire(context.Background(), requestID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			acquired <- requestID
+			release()
+		}(requestID)
+		waitForQueueDepth(t, limiter, depth+1)
+	}
+
+	release()
+	for _, want := range []string{"first", "second", "third"} {
+		if requestID := <-acquired; requestID != want {
+			t.Errorf("slot has been acquired by %q, want %q", requestID, want)
+		}
+	}
+}
+
+func TestLimiterDoesNotLetNewForecastsOvertakeQueuedOnes(t *testing.T) {
+	limiter := NewLimiter(1, 2, zerolog.Nop())
+	release, err := limiter.Acquire(context.Background(), "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := acquireInBackground(context.Background(), limiter, "waiting")
+	waitForQueueDepth(t, limiter, 1)
+
+	// the released slot belongs to the waiting forecast even if it has not
+	// picked up the slot yet, so a new forecast needs to queue up behind it
+	release()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, "new"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := <-waiting; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimiterRemovesCancelledForecastsFromQueue(t *testing.T) {
+	limiter := NewLimiter(1, 1, zerolog.Nop())
+	release, err := limiter.Acquire(context.Background(), "running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := acquireInBackground(ctx, limiter, "cancelled")
+	waitForQueueDepth(t, limiter, 1)
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if depth := queueDepth(limiter); depth != 0 {
+		t.Fatalf("%d forecasts are waiting after the cancellation, want 0", depth)
+	}
+
+	// the slot is freed once the running forecast is done, since nobody is
+	// waiting for it anymore
+	release()
+	if _, err := limiter.Acquire(context.Background(), "next"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingForecaster is a Forecaster which always fails
+type failingForecaster struct{}
+
+func (failingForecaster) Forecast(context.Context, Input, Options) (*Result, error) {
+	return nil, ErrModelFailed
+}
+
+func TestLimitedForecasterReleasesSlotOnError(t *testing.T) {
+	limiter := NewLimiter(1, 0, zerolog.Nop())
+	forecaster := LimitedForecaster{Forecaster: failingForecaster{}, Limiter: limiter}
+	for i := 0; i < 3; i++ {
+		if _, err := forecaster.Forecast(context.Background(), Input{}, Options{}); !errors.Is(err, ErrModelFailed) {
+			t.Fatalf("got error %v, want %v", err, ErrModelFailed)
+		}
+	}
+	release, err := limiter.Acquire(context.Background(), "next")
+	if err != nil {
+		t.Fatalf("slot has not been released after a failed forecast: %v", err)
+	}
+	release()
+}
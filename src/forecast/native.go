@@ -0,0 +1,318 @@
+package forecast
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"microservice/structs"
+)
+
+// NativeForecaster is a model backend written in Go which does not require an
+// R installation. It fits the water usage series with Holt's linear trend
+// method and optionally adds an additive seasonal component (Holt-Winters).
+// The smoothing parameters are selected by minimizing the squared one-step
+// forecast errors and the prediction intervals are derived from the residual
+// variance of the fitted model.
+//
+// If the population is used as regressor, the backend instead fits a linear
+// regression of the total water usage on a linear trend and the recorded
+// population. Logistic growth is approximated by limiting the forecast and its
+// prediction intervals to the floor and the cap. The backend does not support
+// seasonality toggles or changepoints and ignores the changepoint prior scale
+type NativeForecaster struct {
+	// SeasonalPeriod is the length of a seasonal cycle in years. A period
+	// smaller than two disables the seasonal component
+	SeasonalPeriod int
+}
+
+// holtWintersModel contains a fitted model and the states needed to calculate
+// forecasts from it
+type holtWintersModel struct {
+	alpha, beta, gamma float64
+	period             int
+	level, trend       float64
+	seasonals          []float64
+	fitted             []float64
+	// trends contains the level and trend part of the fitted values which
+	// does not contain the seasonal component
+	trends []float64
+	sigma  float64
+}
+
+// smoothingGrid contains the values tried for every smoothing parameter
+var smoothingGrid = []float64{0.05, 0.1, 0.15, 0.2, 0.25, 0.3, 0.35, 0.4, 0.45, 0.5, 0.55, 0.6, 0.65, 0.7,
+	0.75, 0.8, 0.85, 0.9, 0.95}
+
+// Forecast fits the model on the water usage series and calculates the
+// per-person water usage for every population scenario contained in the input
+func (f NativeForecaster) Forecast(_ context.Context, input Input, options Options) (*Result, error) {
+	modelOptions := options.Model
+	if modelOptions.YearlySeasonality || modelOptions.WeeklySeasonality || modelOptions.DailySeasonality {
+		return nil, fmt.Errorf("%w: the seasonal component is configured with NATIVE_SEASONAL_PERIOD",
+			ErrUnsupportedOption)
+	}
+	if len(modelOptions.Changepoints) > 0 {
+		return nil, fmt.Errorf("%w: changepoints are not supported", ErrUnsupportedOption)
+	}
+
+	// select the model which predicts the total water usage of a year with the
+	// population of the scenario
+	var predict func(year int, population float64) (float64, float64)
+	var decompose func(year int, population float64) (float64, map[string]float64)
+	if modelOptions.PopulationMode == PopulationRegressor {
+		model, err := fitPopulationRegression(input.WaterUsages, input.CurrentPopulation)
+		if err != nil {
+			return nil, err
+		}
+		predict, decompose = model.predict, model.decompose
+	} else {
+		values, firstYear, err := annualValues(input.WaterUsages)
+		if err != nil {
+			return nil, err
+		}
+
+		period := f.SeasonalPeriod
+		if period < 2 || len(values) < 2*period+1 {
+			period = 0
+		}
+		model, err := fitHoltWinters(values, period)
+		if err != nil {
+			return nil, err
+		}
+
+		predict = func(year int, _ float64) (float64, float64) {
+			return model.predict(year - firstYear)
+		}
+		decompose = func(year int, _ float64) (float64, map[string]float64) {
+			return model.decompose(year - firstYear)
+		}
+	}
+
+	intervalWidths := options.intervalWidths()
+
+	result := &Result{Scenarios: make(map[string][]structs.OutputDataPoint)}
+	for scenario, futurePopulation := range input.PopulationScenarios {
+		population := append(append([]structs.InputDataPoint{}, input.CurrentPopulation...), futurePopulation...)
+		var dataPoints []structs.OutputDataPoint
+		for _, populationDataPoint := range population {
+			year, err := populationDataPoint.Year()
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse the year of a population data point: %w", err)
+			}
+			forecast, standardError := predict(year, populationDataPoint.Value)
+			dataPoint := normalDataPoint(populationDataPoint.Date, forecast, standardError,
+				populationDataPoint.Value, intervalWidths)
+			if modelOptions.Growth == GrowthLogistic {
+				floor := 0.0
+				if modelOptions.Floor != nil {
+					floor = *modelOptions.Floor
+				}
+				clampDataPoint(&dataPoint, floor/populationDataPoint.Value, *modelOptions.Cap/populationDataPoint.Value)
+			}
+			dataPoints = append(dataPoints, dataPoint)
+
+			if options.IncludeComponents {
+				if result.Components == nil {
+					result.Components = make(map[string][]structs.ComponentPoint)
+				}
+				trend, effects := decompose(year, populationDataPoint.Value)
+				result.Components[scenario] = append(result.Components[scenario], structs.ComponentPoint{
+					Date:    populationDataPoint.Date,
+					Trend:   trend,
+					Effects: effects,
+				})
+			}
+		}
+		result.Scenarios[scenario] = dataPoints
+	}
+
+	// now compare the in-sample predictions with the recorded water usages.
+	// the regression needs the population recorded in the year of the usage
+	if options.IncludeFitted {
+		populationByYear := make(map[int]float64)
+		for _, dataPoint := range input.CurrentPopulation {
+			year, err := dataPoint.Year()
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse the year of a population data point: %w", err)
+			}
+			populationByYear[year] = dataPoint.Value
+		}
+		for _, dataPoint := range input.WaterUsages {
+			year, err := dataPoint.Year()
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse the year of a water usage data point: %w", err)
+			}
+			fitted, standardError := predict(year, populationByYear[year])
+			result.Fitted = append(result.Fitted, fittedPoint(dataPoint.Date, dataPoint.Value, fitted,
+				standardError, intervalWidths[0]))
+		}
+	}
+	return result, nil
+}
+
+// annualValues returns the water usages as series with a value for every year
+// between the first and the last water usage. The smoothing equations need an
+// evenly spaced series, therefore missing years (e.g., dropped outliers) are
+// interpolated linearly between the neighbouring years
+func annualValues(waterUsages []structs.InputDataPoint) ([]float64, int, error) {
+	if len(waterUsages) == 0 {
+		return nil, 0, ErrTooFewDataPoints
+	}
+	firstYear, err := waterUsages[0].Year()
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to parse the first year of the water usages: %w", err)
+	}
+
+	var values []float64
+	previousYear := firstYear - 1
+	for _, dataPoint := range waterUsages {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, 0, fmt.Errorf("unable to parse the year of a water usage data point: %w", err)
+		}
+		if year <= previousYear {
+			return nil, 0, fmt.Errorf("%w: the water usages are not ordered by year", ErrModelFailed)
+		}
+		for missingYear := previousYear + 1; missingYear < year; missingYear++ {
+			previousValue := values[previousYear-firstYear]
+			share := float64(missingYear-previousYear) / float64(year-previousYear)
+			values = append(values, previousValue+share*(dataPoint.Value-previousValue))
+		}
+		values = append(values, dataPoint.Value)
+		previousYear = year
+	}
+	return values, firstYear, nil
+}
+
+// fitHoltWinters selects the smoothing parameters with the smallest sum of
+// squared one-step forecast errors and returns the fitted model. A period of
+// zero fits Holt's linear trend method without a seasonal component
+func fitHoltWinters(values []float64, period int) (*holtWintersModel, error) {
+	if len(values) < 3 {
+		return nil, ErrTooFewDataPoints
+	}
+
+	gammas := []float64{0}
+	if period > 0 {
+		gammas = smoothingGrid
+	}
+
+	var best *holtWintersModel
+	bestError := math.Inf(1)
+	for _, alpha := range smoothingGrid {
+		for _, beta := range smoothingGrid {
+			for _, gamma := range gammas {
+				model, squaredError := runHoltWinters(values, period, alpha, beta, gamma)
+				if squaredError < bestError {
+					best, bestError = model, squaredError
+				}
+			}
+		}
+	}
+
+	// the level and trend (and the seasonal states) are estimated parameters
+	degreesOfFreedom := len(values) - 2 - period
+	if degreesOfFreedom < 1 {
+		degreesOfFreedom = 1
+	}
+	best.sigma = math.Sqrt(bestError / float64(degreesOfFreedom))
+	return best, nil
+}
+
+// runHoltWinters applies the smoothing equations with the supplied parameters
+// and returns the resulting model and its sum of squared one-step errors
+func runHoltWinters(values []float64, period int, alpha, beta, gamma float64) (*holtWintersModel, float64) {
+	model := &holtWintersModel{alpha: alpha, beta: beta, gamma: gamma, period: period}
+	model.fitted = make([]float64, len(values))
+	model.trends = make([]float64, len(values))
+
+	start := 1
+	if period == 0 {
+		model.level = values[0]
+		model.trend = values[1] - values[0]
+		model.fitted[0] = values[0]
+		model.trends[0] = values[0]
+	} else {
+		var firstCycle, secondCycle float64
+		for i := 0; i < period; i++ {
+			firstCycle += values[i]
+			secondCycle += values[period+i]
+		}
+		model.level = firstCycle / float64(period)
+		model.trend = (secondCycle - firstCycle) / float64(period*period)
+		model.seasonals = make([]float64, period)
+		for i := 0; i < period; i++ {
+			model.seasonals[i] = values[i] - model.level
+			model.fitted[i] = values[i]
+			model.trends[i] = model.level
+		}
+		start = period
+	}
+
+	var squaredError float64
+	for t := start; t < len(values); t++ {
+		seasonal := 0.0
+		if period > 0 {
+			seasonal = model.seasonals[t%period]
+		}
+		model.trends[t] = model.level + model.trend
+		model.fitted[t] = model.trends[t] + seasonal
+		squaredError += math.Pow(values[t]-model.fitted[t], 2)
+
+		previousLevel := model.level
+		model.level = alpha*(values[t]-seasonal) + (1-alpha)*(model.level+model.trend)
+		model.trend = beta*(model.level-previousLevel) + (1-beta)*model.trend
+		if period > 0 {
+			model.seasonals[t%period] = gamma*(values[t]-model.level) + (1-gamma)*seasonal
+		}
+	}
+	return model, squaredError
+}
+
+// predict returns the value and the standard error of the model at the index
+// t of the series. Indices inside the fitted series return the in-sample
+// one-step forecast, indices after the series are forecast from the last state
+func (m *holtWintersModel) predict(t int) (float64, float64) {
+	n := len(m.fitted)
+	if t < 0 {
+		t = 0
+	}
+	if t < n {
+		return m.fitted[t], m.sigma
+	}
+
+	h := t - n + 1
+	value := m.level + float64(h)*m.trend
+	if m.period > 0 {
+		value += m.seasonals[(n+h-1)%m.period]
+	}
+
+	variance := 1.0
+	for j := 1; j < h; j++ {
+		coefficient := m.alpha * (1 + float64(j)*m.beta)
+		if m.period > 0 && j%m.period == 0 {
+			coefficient += m.gamma
+		}
+		variance += coefficient * coefficient
+	}
+	return value, m.sigma * math.Sqrt(variance)
+}
+
+// decompose splits the value of the model at the index t of the series into
+// the trend and the seasonal effect
+func (m *holtWintersModel) decompose(t int) (float64, map[string]float64) {
+	n := len(m.fitted)
+	if t < 0 {
+		t = 0
+	}
+	value, _ := m.predict(t)
+	trend := m.level + float64(t-n+1)*m.trend
+	if t < n {
+		trend = m.trends[t]
+	}
+	if m.period == 0 {
+		return trend, nil
+	}
+	return trend, map[string]float64{"seasonal": value - trend}
+}
@@ -0,0 +1,229 @@
+package forecast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"microservice/structs"
+)
+
+// annualSeries builds a series with a data point for every year starting with
+// the first year. The value of a year is calculated from its index
+func annualSeries(firstYear, years int, value func(t int) float64) []structs.InputDataPoint {
+	var series []structs.InputDataPoint
+	for t := 0; t < years; t++ {
+		series = append(series, structs.InputDataPoint{Date: fmt.Sprintf("%d-12-31", firstYear+t), Value: value(t)})
+	}
+	return series
+}
+
+// constant returns a function returning the value for every index
+func constant(value float64) func(int) float64 {
+	return func(int) float64 { return value }
+}
+
+// checkFinite fails the test if any value of the data points is not finite
+func checkFinite(t *testing.T, dataPoints []structs.OutputDataPoint) {
+	t.Helper()
+	for _, dataPoint := range dataPoints {
+		values := []float64{dataPoint.LowerBound, dataPoint.Forecast, dataPoint.UpperBound}
+		for _, band := range dataPoint.Intervals {
+			values = append(values, band.LowerBound, band.UpperBound)
+		}
+		for _, value := range values {
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				t.Fatalf("data point %s contains the value %v", dataPoint.Date, value)
+			}
+		}
+	}
+}
+
+func TestNativeForecastLinearSeries(t *testing.T) {
+	// the population is not collinear with the years, otherwise the regression
+	// could not separate the trend from the population
+	population := func(t int) float64 { return 100 + float64(t%3) }
+	tests := []struct {
+		name  string
+		mode  string
+		usage func(t int) float64
+	}{
+		{"division", PopulationDivision, func(t int) float64 { return 1000 + 50*float64(t) }},
+		{"regressor", PopulationRegressor, func(t int) float64 { return 1000 + 50*float64(t) + 3*population(t) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := Input{
+				WaterUsages:       annualSeries(2011, 10, test.usage),
+				CurrentPopulation: annualSeries(2011, 10, population),
+				PopulationScenarios: map[string][]structs.InputDataPoint{
+					"medium": annualSeries(2021, 5, func(t int) float64 { return population(t + 10) }),
+				},
+			}
+			options := Options{Model: structs.ModelOptions{PopulationMode: test.mode}}
+			result, err := NativeForecaster{}.Forecast(context.Background(), input, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataPoints := result.Scenarios["medium"]
+			if len(dataPoints) != 15 {
+				t.Fatalf("got %d data points, want 15", len(dataPoints))
+			}
+			for i, dataPoint := range dataPoints {
+				want := test.usage(i) / population(i)
+				if math.Abs(dataPoint.Forecast-want) > 1e-6 {
+					t.Errorf("forecast of %s is %f, want %f", dataPoint.Date, dataPoint.Forecast, want)
+				}
+				if dataPoint.UpperBound-dataPoint.LowerBound > 1e-6 {
+					t.Errorf("interval of %s has a width of %f for an exact fit", dataPoint.Date,
+						dataPoint.UpperBound-dataPoint.LowerBound)
+				}
+			}
+		})
+	}
+}
+
+func TestNativeForecastIntervalsGrowWithHorizon(t *testing.T) {
+	input := Input{
+		WaterUsages: annualSeries(2001, 20, func(t int) float64 {
+			return 1000 + 20*float64(t) + 15*math.Sin(float64(t*t))
+		}),
+		CurrentPopulation: annualSeries(2001, 20, constant(100)),
+		PopulationScenarios: map[string][]structs.InputDataPoint{
+			"medium": annualSeries(2021, 10, constant(100)),
+		},
+	}
+	options := Options{IntervalWidths: []float64{0.8, 0.95}}
+	result, err := NativeForecaster{}.Forecast(context.Background(), input, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataPoints := result.Scenarios["medium"][20:]
+	previousWidth := 0.0
+	for _, dataPoint := range dataPoints {
+		narrow, wide := dataPoint.Intervals[IntervalName(0.8)], dataPoint.Intervals[IntervalName(0.95)]
+		width := narrow.UpperBound - narrow.LowerBound
+		if width <= previousWidth {
+			t.Errorf("interval of %s has a width of %f which does not exceed %f", dataPoint.Date, width,
+				previousWidth)
+		}
+		if wide.UpperBound-wide.LowerBound <= width {
+			t.Errorf("95%% interval of %s is not wider than the 80%% interval", dataPoint.Date)
+		}
+		if dataPoint.LowerBound != narrow.LowerBound || dataPoint.UpperBound != narrow.UpperBound {
+			t.Errorf("bounds of %s do not match the first interval", dataPoint.Date)
+		}
+		previousWidth = width
+	}
+}
+
+func TestNativeForecastRegressionFollowsPopulation(t *testing.T) {
+	population := func(t int) float64 { return 1000 + 10*float64(t) + 7*float64(t%3) }
+	input := Input{
+		WaterUsages: annualSeries(2011, 10, func(t int) float64 {
+			return 5000 - 20*float64(t) + 40*population(t) + 3*math.Sin(float64(t))
+		}),
+		CurrentPopulation: annualSeries(2011, 10, population),
+		PopulationScenarios: map[string][]structs.InputDataPoint{
+			"low":  annualSeries(2021, 5, constant(1000)),
+			"high": annualSeries(2021, 5, constant(1500)),
+		},
+	}
+	options := Options{Model: structs.ModelOptions{PopulationMode: PopulationRegressor}, IncludeComponents: true}
+	result, err := NativeForecaster{}.Forecast(context.Background(), input, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 10; i < 15; i++ {
+		low, high := result.Scenarios["low"][i], result.Scenarios["high"][i]
+		slope := (high.Forecast*1500 - low.Forecast*1000) / 500
+		if math.Abs(slope-40) > 0.5 {
+			t.Errorf("total water usage of %s grows by %f per person, want 40", low.Date, slope)
+		}
+		lowEffect := result.Components["low"][i].Effects["population"]
+		highEffect := result.Components["high"][i].Effects["population"]
+		if math.Abs((highEffect-lowEffect)/500-slope) > 1e-6 {
+			t.Errorf("population effect of %s does not match the slope of the forecast", low.Date)
+		}
+	}
+}
+
+func TestNativeForecastDegenerateInputs(t *testing.T) {
+	tests := []struct {
+		name        string
+		usages      []structs.InputDataPoint
+		population  []structs.InputDataPoint
+		mode        string
+		seasonality int
+		wantErr     error
+	}{
+		{"two water usages", annualSeries(2019, 2, constant(1000)), annualSeries(2019, 2, constant(10)),
+			PopulationDivision, 0, ErrTooFewDataPoints},
+		{"three water usages with regressor", annualSeries(2018, 3, func(t int) float64 { return float64(t) }),
+			annualSeries(2018, 3, func(t int) float64 { return float64(t * t) }), PopulationRegressor, 0,
+			ErrTooFewDataPoints},
+		{"constant water usages", annualSeries(2011, 10, constant(1000)), annualSeries(2011, 10, constant(10)),
+			PopulationDivision, 0, nil},
+		{"constant water usages with season", annualSeries(2011, 10, constant(1000)),
+			annualSeries(2011, 10, constant(10)), PopulationDivision, 3, nil},
+		{"constant water usages with regressor", annualSeries(2011, 10, constant(1000)),
+			annualSeries(2011, 10, func(t int) float64 { return 10 + float64(t%2) }), PopulationRegressor, 0, nil},
+		{"constant population with regressor", annualSeries(2011, 10, func(t int) float64 { return float64(t) }),
+			annualSeries(2011, 10, constant(10)), PopulationRegressor, 0, ErrModelFailed},
+		{"population growing with the trend", annualSeries(2011, 10, func(t int) float64 { return float64(t) }),
+			annualSeries(2011, 10, func(t int) float64 { return 10 + float64(t) }), PopulationRegressor, 0,
+			ErrModelFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := Input{
+				WaterUsages:       test.usages,
+				CurrentPopulation: test.population,
+				PopulationScenarios: map[string][]structs.InputDataPoint{
+					"medium": annualSeries(2021, 3, constant(10)),
+				},
+			}
+			options := Options{
+				Model:         structs.ModelOptions{PopulationMode: test.mode},
+				IncludeFitted: true,
+			}
+			result, err := NativeForecaster{SeasonalPeriod: test.seasonality}.Forecast(context.Background(), input,
+				options)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("got error %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFinite(t, result.Scenarios["medium"])
+			for _, fitted := range result.Fitted {
+				if math.IsNaN(fitted.Fitted) || math.IsNaN(fitted.LowerBound) || math.IsNaN(fitted.UpperBound) {
+					t.Fatalf("fitted value of %s is not a number", fitted.Date)
+				}
+			}
+		})
+	}
+}
+
+func TestAnnualValuesInterpolatesMissingYears(t *testing.T) {
+	usages := []structs.InputDataPoint{
+		{Date: "2011-12-31", Value: 100},
+		{Date: "2014-12-31", Value: 130},
+		{Date: "2015-12-31", Value: 120},
+	}
+	values, firstYear, err := annualValues(usages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstYear != 2011 {
+		t.Errorf("series starts with %d, want 2011", firstYear)
+	}
+	if want := []float64{100, 110, 120, 130, 120}; fmt.Sprint(values) != fmt.Sprint(want) {
+		t.Errorf("got values %v, want %v", values, want)
+	}
+}
@@ -0,0 +1,144 @@
+package forecast
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"microservice/structs"
+)
+
+// The methods which detect outliers in the recorded water usages. The median
+// absolute deviation (MAD) flags values which deviate from the median by more
+// than the threshold times the scaled MAD. The interquartile range (IQR) flags
+// values which lie further than the threshold times the IQR outside the quartiles
+const (
+	OutlierMAD = "mad"
+	OutlierIQR = "iqr"
+)
+
+// The actions which are applied to the detected outliers. Kept outliers are
+// only reported, dropped outliers are removed from the series and winsorized
+// outliers are replaced by the nearest bound
+const (
+	OutlierKeep      = "keep"
+	OutlierDrop      = "drop"
+	OutlierWinsorize = "winsorize"
+)
+
+// DefaultOutlierThresholds contains the threshold of every method which is
+// used if the request does not set a threshold
+var DefaultOutlierThresholds = map[string]float64{
+	OutlierMAD: 3.5,
+	OutlierIQR: 1.5,
+}
+
+// minimumOutlierDataPoints is the number of per-person water usages needed to
+// detect outliers. Shorter series are not checked for outliers
+const minimumOutlierDataPoints = 4
+
+// madScale scales the median absolute deviation to the standard deviation of a
+// normal distribution
+const madScale = 1.4826
+
+// CleanOutliers detects outliers in the per-person water usages of the years
+// with a recorded population and applies the action of the options to them.
+// Years without a recorded population are not checked. The returned report
+// lists the flagged years
+func CleanOutliers(waterUsages, population []structs.InputDataPoint, options structs.OutlierOptions) (
+	[]structs.InputDataPoint, *structs.OutlierReport, error) {
+	populationByYear := make(map[int]float64)
+	for _, dataPoint := range population {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse the year of a population data point: %w", err)
+		}
+		populationByYear[year] = dataPoint.Value
+	}
+
+	years := make([]int, len(waterUsages))
+	var perPersonUsages []float64
+	for i, dataPoint := range waterUsages {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to parse the year of a water usage data point: %w", err)
+		}
+		years[i] = year
+		if populationByYear[year] > 0 {
+			perPersonUsages = append(perPersonUsages, dataPoint.Value/populationByYear[year])
+		}
+	}
+
+	report := &structs.OutlierReport{OutlierOptions: options, Outliers: []structs.Outlier{}}
+	if len(perPersonUsages) < minimumOutlierDataPoints {
+		return waterUsages, report, nil
+	}
+	report.LowerBound, report.UpperBound = outlierBounds(perPersonUsages, options.Method, options.Threshold)
+
+	var cleanedUsages []structs.InputDataPoint
+	for i, dataPoint := range waterUsages {
+		yearPopulation := populationByYear[years[i]]
+		if yearPopulation <= 0 {
+			cleanedUsages = append(cleanedUsages, dataPoint)
+			continue
+		}
+		perPersonUsage := dataPoint.Value / yearPopulation
+		if perPersonUsage >= report.LowerBound && perPersonUsage <= report.UpperBound {
+			cleanedUsages = append(cleanedUsages, dataPoint)
+			continue
+		}
+
+		outlier := structs.Outlier{Year: years[i], Value: perPersonUsage}
+		switch options.Action {
+		case OutlierKeep:
+			cleanedUsages = append(cleanedUsages, dataPoint)
+		case OutlierWinsorize:
+			replacement := math.Max(report.LowerBound, math.Min(report.UpperBound, perPersonUsage))
+			outlier.Replacement = &replacement
+			cleanedUsages = append(cleanedUsages, structs.InputDataPoint{
+				Date:  dataPoint.Date,
+				Value: replacement * yearPopulation,
+			})
+		}
+		report.Outliers = append(report.Outliers, outlier)
+	}
+	return cleanedUsages, report, nil
+}
+
+// outlierBounds returns the range of the values which are no outliers. If the
+// spread of the values is zero, the range contains all values
+func outlierBounds(values []float64, method string, threshold float64) (float64, float64) {
+	sortedValues := append([]float64{}, values...)
+	sort.Float64s(sortedValues)
+
+	var lower, upper float64
+	switch method {
+	case OutlierIQR:
+		firstQuartile, thirdQuartile := quantile(sortedValues, 0.25), quantile(sortedValues, 0.75)
+		spread := thirdQuartile - firstQuartile
+		lower, upper = firstQuartile-threshold*spread, thirdQuartile+threshold*spread
+	default:
+		median := quantile(sortedValues, 0.5)
+		deviations := make([]float64, len(sortedValues))
+		for i, value := range sortedValues {
+			deviations[i] = math.Abs(value - median)
+		}
+		sort.Float64s(deviations)
+		spread := madScale * quantile(deviations, 0.5)
+		lower, upper = median-threshold*spread, median+threshold*spread
+	}
+	if lower == upper {
+		return sortedValues[0], sortedValues[len(sortedValues)-1]
+	}
+	return lower, upper
+}
+
+// quantile returns the quantile p of the sorted values. Between two values, the
+// quantile is interpolated linearly
+func quantile(sortedValues []float64, p float64) float64 {
+	position := p * float64(len(sortedValues)-1)
+	lowerIndex := int(math.Floor(position))
+	upperIndex := int(math.Ceil(position))
+	fraction := position - float64(lowerIndex)
+	return sortedValues[lowerIndex] + fraction*(sortedValues[upperIndex]-sortedValues[lowerIndex])
+}
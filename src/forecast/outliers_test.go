@@ -0,0 +1,152 @@
+package forecast
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"microservice/structs"
+)
+
+// valueSeries builds a series with the values starting with the first year
+func valueSeries(firstYear int, values ...float64) []structs.InputDataPoint {
+	return annualSeries(firstYear, len(values), func(t int) float64 { return values[t] })
+}
+
+// hasWarning reports whether the data quality report contains a warning with
+// the code which lists the year
+func hasWarning(quality *structs.DataQuality, code string, year int) bool {
+	for _, warning := range quality.Warnings {
+		if warning.Code != code {
+			continue
+		}
+		for _, warningYear := range warning.Years {
+			if warningYear == year {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestOutlierBounds(t *testing.T) {
+	tests := []struct {
+		name         string
+		values       []float64
+		method       string
+		threshold    float64
+		lower, upper float64
+	}{
+		// median 3, median absolute deviation 1
+		{"mad", []float64{1, 2, 3, 4, 100}, OutlierMAD, 3.5, 3 - 3.5*madScale, 3 + 3.5*madScale},
+		// first quartile 2, third quartile 4
+		{"iqr", []float64{100, 1, 2, 3, 4}, OutlierIQR, 1.5, -1, 7},
+		{"interpolated quartiles", []float64{1, 2, 3, 4, 5, 6}, OutlierIQR, 1, -0.25, 7.25},
+		{"zero mad", []float64{5, 5, 5, 5, 9}, OutlierMAD, 3.5, 5, 9},
+		{"zero iqr", []float64{5, 5, 5, 9, 5, 5}, OutlierIQR, 1.5, 5, 9},
+		{"constant values", []float64{5, 5, 5, 5}, OutlierMAD, 3.5, 5, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lower, upper := outlierBounds(test.values, test.method, test.threshold)
+			if math.Abs(lower-test.lower) > 1e-9 || math.Abs(upper-test.upper) > 1e-9 {
+				t.Errorf("got bounds [%f, %f], want [%f, %f]", lower, upper, test.lower, test.upper)
+			}
+		})
+	}
+}
+
+func TestCleanOutliers(t *testing.T) {
+	// the population doubles the water usages, so the per-person water usage
+	// of 2015 is 50 while the other years lie between 1 and 4
+	waterUsages := valueSeries(2011, 2, 4, 6, 8, 100, 4)
+	population := annualSeries(2011, 6, constant(2))
+
+	// the quartiles of the per-person water usages are 2 and 3.75, therefore
+	// the upper bound is 3.75 + 1.5 * 1.75
+	upperBound := 6.375
+	tests := []struct {
+		action   string
+		usages   []float64
+		years    []int
+		replaced bool
+	}{
+		{OutlierKeep, []float64{2, 4, 6, 8, 100, 4}, []int{2011, 2012, 2013, 2014, 2015, 2016}, false},
+		{OutlierDrop, []float64{2, 4, 6, 8, 4}, []int{2011, 2012, 2013, 2014, 2016}, false},
+		{OutlierWinsorize, []float64{2, 4, 6, 8, 2 * upperBound, 4}, []int{2011, 2012, 2013, 2014, 2015, 2016}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			options := structs.OutlierOptions{Method: OutlierIQR, Threshold: 1.5, Action: test.action}
+			cleanedUsages, report, err := CleanOutliers(waterUsages, population, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var values []float64
+			var years []int
+			for _, dataPoint := range cleanedUsages {
+				year, _ := dataPoint.Year()
+				values = append(values, dataPoint.Value)
+				years = append(years, year)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(test.usages) || fmt.Sprint(years) != fmt.Sprint(test.years) {
+				t.Errorf("got water usages %v in %v, want %v in %v", values, years, test.usages, test.years)
+			}
+			if report.UpperBound != upperBound {
+				t.Errorf("got upper bound %f, want %f", report.UpperBound, upperBound)
+			}
+			if len(report.Outliers) != 1 {
+				t.Fatalf("got %d outliers, want 1", len(report.Outliers))
+			}
+			outlier := report.Outliers[0]
+			if outlier.Year != 2015 || outlier.Value != 50 {
+				t.Errorf("got outlier %+v, want 50 in 2015", outlier)
+			}
+			if test.replaced != (outlier.Replacement != nil) {
+				t.Fatalf("replacement set: %t, want %t", outlier.Replacement != nil, test.replaced)
+			}
+			if test.replaced && *outlier.Replacement != upperBound {
+				t.Errorf("outlier replaced by %f, want %f", *outlier.Replacement, upperBound)
+			}
+
+			// the cleaned series is aligned with the population again in the
+			// following steps, so a dropped year may not break the alignment
+			alignedUsages, _, quality, err := AlignSeries(cleanedUsages, population, GapInterpolate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(alignedUsages) != 6 {
+				t.Errorf("aligned series contains %d years, want 6", len(alignedUsages))
+			}
+			if test.action == OutlierDrop && !hasWarning(quality, WarningInterpolatedYears, 2015) {
+				t.Errorf("dropped year has not been interpolated: %+v", quality.Warnings)
+			}
+		})
+	}
+}
+
+func TestCleanOutliersSkipsShortSeriesAndMissingPopulation(t *testing.T) {
+	options := structs.OutlierOptions{Method: OutlierMAD, Threshold: 3.5, Action: OutlierDrop}
+
+	// three per-person water usages are too few to detect outliers
+	waterUsages := valueSeries(2011, 1, 1, 1, 100)
+	population := valueSeries(2011, 1, 1, 1)
+	cleanedUsages, report, err := CleanOutliers(waterUsages, population, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleanedUsages) != 4 || len(report.Outliers) != 0 {
+		t.Errorf("short series has been cleaned: %v, %+v", cleanedUsages, report.Outliers)
+	}
+
+	// the water usage of a year without population is kept unchecked
+	waterUsages = valueSeries(2011, 1, 2, 3, 2, 1, 100)
+	population = valueSeries(2011, 1, 1, 1, 1, 1)
+	cleanedUsages, report, err = CleanOutliers(waterUsages, population, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cleanedUsages) != 6 || len(report.Outliers) != 0 {
+		t.Errorf("year without population has been cleaned: %v, %+v", cleanedUsages, report.Outliers)
+	}
+}
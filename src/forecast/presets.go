@@ -0,0 +1,114 @@
+package forecast
+
+import (
+	"errors"
+	"fmt"
+
+	"microservice/structs"
+)
+
+// GrowthLinear selects a linear trend for the model
+const GrowthLinear = "linear"
+
+// GrowthLogistic selects a saturating trend for the model which is limited by
+// a cap and a floor
+const GrowthLogistic = "logistic"
+
+// PopulationDivision selects a model which forecasts the total water usage
+// without considering the population. The per-person usage is calculated by
+// dividing the forecast by the population of every scenario
+const PopulationDivision = "division"
+
+// PopulationRegressor selects a model which uses the population as external
+// regressor. The model is fitted on the recorded population and every
+// population scenario drives a separate prediction
+const PopulationRegressor = "regressor"
+
+// DefaultPreset is the name of the preset used if a request did not select a
+// preset
+const DefaultPreset = "default"
+
+// ErrUnsupportedOption is returned by a backend if the model options contain
+// an option the backend is not able to apply
+var ErrUnsupportedOption = errors.New("the model backend does not support the option")
+
+// Presets contains the default model options for every named preset. None of
+// the presets enables a seasonal component since the water usages are
+// recorded once a year
+var Presets = map[string]structs.ModelOptions{
+	DefaultPreset: {
+		Preset:                DefaultPreset,
+		Growth:                GrowthLinear,
+		PopulationMode:        PopulationDivision,
+		ChangepointPriorScale: 0.05,
+	},
+	"conservative": {
+		Preset:                "conservative",
+		Growth:                GrowthLinear,
+		PopulationMode:        PopulationDivision,
+		ChangepointPriorScale: 0.01,
+	},
+	"flexible": {
+		Preset:                "flexible",
+		Growth:                GrowthLinear,
+		PopulationMode:        PopulationDivision,
+		ChangepointPriorScale: 0.5,
+	},
+}
+
+// OptionError is returned by ValidateModelOptions if a model option contains
+// an invalid value
+type OptionError struct {
+	// Option is the name of the invalid option
+	Option string
+
+	// Reason describes why the value is invalid
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid model option %s: %s", e.Option, e.Reason)
+}
+
+// ValidateModelOptions checks if the model options are consistent. The
+// changepoints are not checked against the water usage series
+func ValidateModelOptions(options structs.ModelOptions) error {
+	switch options.Growth {
+	case GrowthLinear:
+		if options.Cap != nil {
+			return &OptionError{"cap", "the cap may only be set for logistic growth"}
+		}
+		if options.Floor != nil {
+			return &OptionError{"floor", "the floor may only be set for logistic growth"}
+		}
+	case GrowthLogistic:
+		if options.Cap == nil {
+			return &OptionError{"cap", "logistic growth requires a cap"}
+		}
+		floor := 0.0
+		if options.Floor != nil {
+			floor = *options.Floor
+		}
+		if floor < 0 {
+			return &OptionError{"floor", "expected a positive number"}
+		}
+		if *options.Cap <= floor {
+			return &OptionError{"cap", "the cap needs to be greater than the floor"}
+		}
+	default:
+		return &OptionError{"growth", fmt.Sprintf("expected '%s' or '%s'", GrowthLinear, GrowthLogistic)}
+	}
+	if options.PopulationMode != PopulationDivision && options.PopulationMode != PopulationRegressor {
+		return &OptionError{"populationMode", fmt.Sprintf("expected '%s' or '%s'", PopulationDivision,
+			PopulationRegressor)}
+	}
+	if options.ChangepointPriorScale <= 0 {
+		return &OptionError{"changepointPriorScale", "expected a number greater than zero"}
+	}
+	for i := 1; i < len(options.Changepoints); i++ {
+		if options.Changepoints[i] <= options.Changepoints[i-1] {
+			return &OptionError{"changepoint", "expected distinct years in ascending order"}
+		}
+	}
+	return nil
+}
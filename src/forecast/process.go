@@ -0,0 +1,167 @@
+package forecast
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"microservice/vars"
+	"microservice/workspace"
+)
+
+// ErrorClass maps a pattern found in the error output of a model process to
+// the error describing the failure
+type ErrorClass struct {
+	Pattern *regexp.Regexp
+	Err     error
+}
+
+// RScriptErrorClasses contains the known failure classes of the prophet-based
+// R script
+var RScriptErrorClasses = []ErrorClass{
+	{regexp.MustCompile(`less than 2 non-NA rows`), ErrTooFewDataPoints},
+	{
+		regexp.MustCompile(`replacement has \d+ rows?, data has \d+|no population recorded for \d+ water usage rows`),
+		ErrSeriesLengthMismatch,
+	},
+	{regexp.MustCompile(`there is no package called`), ErrMissingDependency},
+}
+
+// ProcessForecaster calculates the forecast by executing a model process which
+// implements the protocol described by ModelRequest and ModelResponse. The
+// request document is piped to the process on stdin while the response
+// document is read from its stdout
+type ProcessForecaster struct {
+	// Command is the executable which is started for every forecast
+	Command string
+
+	// Arguments are passed to the executable
+	Arguments []string
+
+	// MinimumDataPoints is the number of water usage data points the model
+	// needs at least to be fitted
+	MinimumDataPoints int
+
+	// ErrorClasses contains the known failure classes of the model process
+	ErrorClasses []ErrorClass
+
+	// Workspaces creates the private working directories of the model process
+	Workspaces *workspace.Manager
+}
+
+// NewRScriptForecaster creates a ProcessForecaster executing the prophet-based
+// R script located at the supplied path. Since the script is executed inside a
+// workspace, relative paths are resolved against the current directory
+func NewRScriptForecaster(scriptPath string, workspaces *workspace.Manager) (ProcessForecaster, error) {
+	absoluteScriptPath, err := filepath.Abs(scriptPath)
+	if err != nil {
+		return ProcessForecaster{}, err
+	}
+	return ProcessForecaster{
+		Command:           "Rscript",
+		Arguments:         []string{absoluteScriptPath},
+		MinimumDataPoints: 2,
+		ErrorClasses:      RScriptErrorClasses,
+		Workspaces:        workspaces,
+	}, nil
+}
+
+// Forecast executes the model process in a new workspace and exchanges the
+// documents with it. If the context is cancelled, the model process is killed.
+// The workspace is removed once the model process has finished
+func (f ProcessForecaster) Forecast(ctx context.Context, input Input, options Options) (*Result, error) {
+	logger := vars.HttpLogger.With().Str("requestID", options.RequestID).Logger()
+
+	if len(input.WaterUsages) < f.MinimumDataPoints {
+		return nil, ErrTooFewDataPoints
+	}
+
+	requestDocument, err := json.Marshal(newModelRequest(input, options))
+	if err != nil {
+		return nil, err
+	}
+
+	var result *Result
+	err = f.Workspaces.Run(ctx, func(workspace workspace.Workspace) error {
+		var executionError error
+		result, executionError = f.execute(ctx, workspace, requestDocument, input, options, logger)
+		return executionError
+	})
+	return result, err
+}
+
+// execute runs the model process inside the workspace. The request document
+// and the error output of the model process are kept in the workspace to allow
+// debugging quarantined runs
+func (f ProcessForecaster) execute(
+	ctx context.Context, workspace workspace.Workspace, requestDocument []byte, input Input, options Options,
+	logger zerolog.Logger,
+) (*Result, error) {
+	err := os.WriteFile(workspace.File("request.json"), requestDocument, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	// now execute the model process. the process is killed if the context is
+	// cancelled
+	var stdout, stderr bytes.Buffer
+	process := exec.CommandContext(ctx, f.Command, f.Arguments...)
+	process.Dir = workspace.Path
+	process.Env = append(os.Environ(), "TMPDIR="+workspace.Path)
+	process.Stdin = bytes.NewReader(requestDocument)
+	process.Stdout = &stdout
+	process.Stderr = &stderr
+	logger.Info().Str("command", f.Command).Msg("starting prognosis via model process")
+	executionStartTime := time.Now()
+	err = process.Run()
+	_ = os.WriteFile(workspace.File("stderr.log"), stderr.Bytes(), 0o600)
+	if ctx.Err() != nil {
+		logger.Warn().Msg("killed model process since the forecast was cancelled")
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("stderr", stderr.String()).Msg("model process failed")
+		return nil, f.classifyError(err, stderr.String())
+	}
+	executionTime := time.Since(executionStartTime)
+	logger.Info().Str("executionTime", executionTime.String()).Msg("finished prognosis via model process")
+	if stderr.Len() > 0 {
+		logger.Debug().Str("stderr", stderr.String()).Msg("model process wrote to stderr")
+	}
+
+	// now read the response document
+	var responseDocument ModelResponse
+	err = json.Unmarshal(stdout.Bytes(), &responseDocument)
+	if err != nil {
+		_ = os.WriteFile(workspace.File("response.json"), stdout.Bytes(), 0o600)
+		return nil, fmt.Errorf("%w: unable to parse model response: %s", ErrModelFailed, err)
+	}
+	result, err := responseDocument.result(input, options)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrModelFailed, err)
+	}
+	return result, nil
+}
+
+// classifyError matches the error output of the model process against the
+// known failure classes. If no failure class matches, ErrModelFailed is
+// returned together with the last line of the error output
+func (f ProcessForecaster) classifyError(err error, stderr string) error {
+	for _, errorClass := range f.ErrorClasses {
+		if errorClass.Pattern.MatchString(stderr) {
+			return errorClass.Err
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	return fmt.Errorf("%w: %s: %s", ErrModelFailed, err, lines[len(lines)-1])
+}
@@ -0,0 +1,26 @@
+package forecast
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyRScriptErrors(t *testing.T) {
+	forecaster := ProcessForecaster{ErrorClasses: RScriptErrorClasses}
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"Error in fit.prophet(m, df, ...) : Dataframe has less than 2 non-NA rows.", ErrTooFewDataPoints},
+		{"Error: no population recorded for 2 water usage rows", ErrSeriesLengthMismatch},
+		{"Error in `$<-.data.frame`(`*tmp*`, y, value = 1:3) :\n  replacement has 3 rows, data has 4",
+			ErrSeriesLengthMismatch},
+		{"Error in library(prophet) : there is no package called 'prophet'", ErrMissingDependency},
+		{"Error in optimizing(...) : something unexpected happened", ErrModelFailed},
+	}
+	for _, test := range tests {
+		if err := forecaster.classifyError(errors.New("exit status 1"), test.stderr); !errors.Is(err, test.want) {
+			t.Errorf("error output %q classified as %v, want %v", test.stderr, err, test.want)
+		}
+	}
+}
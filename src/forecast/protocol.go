@@ -0,0 +1,68 @@
+package forecast
+
+import (
+	"fmt"
+
+	"microservice/structs"
+)
+
+// ProtocolVersion is the version of the protocol spoken with model processes.
+// A model process receives a single ModelRequest document on stdin and writes
+// a single ModelResponse document to stdout. Every other output of the model
+// process needs to be written to stderr
+const ProtocolVersion = 1
+
+// ModelRequest is the document sent to a model process
+type ModelRequest struct {
+	Version             int                                 `json:"version"`
+	WaterUsages         []structs.InputDataPoint            `json:"waterUsages"`
+	CurrentPopulation   []structs.InputDataPoint            `json:"currentPopulation"`
+	PopulationScenarios map[string][]structs.InputDataPoint `json:"populationScenarios"`
+	IntervalWidths      []float64                           `json:"intervalWidths"`
+	ModelOptions        structs.ModelOptions                `json:"modelOptions"`
+	IncludeComponents   bool                                `json:"includeComponents"`
+	IncludeFitted       bool                                `json:"includeFitted"`
+}
+
+// ModelResponse is the document returned by a model process
+type ModelResponse struct {
+	Version    int                                  `json:"version"`
+	Scenarios  map[string][]structs.OutputDataPoint `json:"scenarios"`
+	Components map[string][]structs.ComponentPoint  `json:"components,omitempty"`
+	Fitted     []structs.FittedPoint                `json:"fitted,omitempty"`
+}
+
+// newModelRequest builds the document sent to a model process from the input
+// and the options
+func newModelRequest(input Input, options Options) ModelRequest {
+	return ModelRequest{
+		Version:             ProtocolVersion,
+		WaterUsages:         input.WaterUsages,
+		CurrentPopulation:   input.CurrentPopulation,
+		PopulationScenarios: input.PopulationScenarios,
+		IntervalWidths:      options.intervalWidths(),
+		ModelOptions:        options.Model,
+		IncludeComponents:   options.IncludeComponents,
+		IncludeFitted:       options.IncludeFitted,
+	}
+}
+
+// result validates the response of a model process against the input and the
+// options it has been calculated from and converts the response into a Result
+func (r ModelResponse) result(input Input, options Options) (*Result, error) {
+	if r.Version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d in model response", r.Version)
+	}
+	for scenario := range input.PopulationScenarios {
+		if len(r.Scenarios[scenario]) == 0 {
+			return nil, fmt.Errorf("model response does not contain a forecast for scenario '%s'", scenario)
+		}
+		if options.IncludeComponents && len(r.Components[scenario]) == 0 {
+			return nil, fmt.Errorf("model response does not contain the components of scenario '%s'", scenario)
+		}
+	}
+	if options.IncludeFitted && len(r.Fitted) == 0 {
+		return nil, fmt.Errorf("model response does not contain the fitted water usages")
+	}
+	return &Result{Scenarios: r.Scenarios, Components: r.Components, Fitted: r.Fitted}, nil
+}
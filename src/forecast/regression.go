@@ -0,0 +1,117 @@
+package forecast
+
+import (
+	"fmt"
+	"math"
+
+	"microservice/structs"
+)
+
+// populationRegression is a linear model of the total water usage with a
+// linear trend and the population as regressor. The regressors are centered
+// before fitting to keep the normal equations well conditioned
+type populationRegression struct {
+	intercept, trendSlope, populationSlope float64
+	meanYear, meanPopulation               float64
+	// inverse contains the inverse of the centered cross-product matrix of the
+	// regressors which is needed for the standard error of a prediction
+	inverse      [2][2]float64
+	observations int
+	sigma        float64
+}
+
+// fitPopulationRegression fits the regression on the water usages and the
+// population recorded in the same years. Every water usage needs a population
+// data point of the same year
+func fitPopulationRegression(waterUsages, population []structs.InputDataPoint) (*populationRegression, error) {
+	populationByYear := make(map[int]float64)
+	for _, dataPoint := range population {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the year of a population data point: %w", err)
+		}
+		populationByYear[year] = dataPoint.Value
+	}
+
+	var years, populations, usages []float64
+	for _, dataPoint := range waterUsages {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the year of a water usage data point: %w", err)
+		}
+		yearPopulation, populationRecorded := populationByYear[year]
+		if !populationRecorded {
+			return nil, fmt.Errorf("%w: no population has been recorded for %d", ErrSeriesLengthMismatch, year)
+		}
+		years = append(years, float64(year))
+		populations = append(populations, yearPopulation)
+		usages = append(usages, dataPoint.Value)
+	}
+
+	// the intercept and both slopes are estimated parameters. at least one
+	// degree of freedom is needed to estimate the residual variance
+	n := len(usages)
+	if n < 4 {
+		return nil, ErrTooFewDataPoints
+	}
+
+	model := &populationRegression{
+		meanYear:       mean(years),
+		meanPopulation: mean(populations),
+		intercept:      mean(usages),
+		observations:   n,
+	}
+	var sYY, sYP, sPP, sYU, sPU float64
+	for i := range usages {
+		year := years[i] - model.meanYear
+		population := populations[i] - model.meanPopulation
+		usage := usages[i] - model.intercept
+		sYY += year * year
+		sYP += year * population
+		sPP += population * population
+		sYU += year * usage
+		sPU += population * usage
+	}
+	determinant := sYY*sPP - sYP*sYP
+	if determinant <= 1e-9*sYY*sPP {
+		return nil, fmt.Errorf("%w: the population is collinear with the trend", ErrModelFailed)
+	}
+	model.inverse = [2][2]float64{{sPP / determinant, -sYP / determinant}, {-sYP / determinant, sYY / determinant}}
+	model.trendSlope = model.inverse[0][0]*sYU + model.inverse[0][1]*sPU
+	model.populationSlope = model.inverse[1][0]*sYU + model.inverse[1][1]*sPU
+
+	var squaredError float64
+	for i := range usages {
+		fitted, _ := model.predict(int(years[i]), populations[i])
+		squaredError += math.Pow(usages[i]-fitted, 2)
+	}
+	model.sigma = math.Sqrt(squaredError / float64(n-3))
+	return model, nil
+}
+
+// predict returns the total water usage and the standard error of the
+// prediction for a year with the supplied population
+func (m *populationRegression) predict(year int, population float64) (float64, float64) {
+	x := [2]float64{float64(year) - m.meanYear, population - m.meanPopulation}
+	value := m.intercept + m.trendSlope*x[0] + m.populationSlope*x[1]
+	leverage := 1/float64(m.observations) +
+		x[0]*(m.inverse[0][0]*x[0]+m.inverse[0][1]*x[1]) +
+		x[1]*(m.inverse[1][0]*x[0]+m.inverse[1][1]*x[1])
+	return value, m.sigma * math.Sqrt(1+leverage)
+}
+
+// decompose splits the total water usage predicted for a year with the supplied
+// population into the trend and the effect of the population
+func (m *populationRegression) decompose(year int, population float64) (float64, map[string]float64) {
+	trend := m.intercept + m.trendSlope*(float64(year)-m.meanYear)
+	return trend, map[string]float64{"population": m.populationSlope * (population - m.meanPopulation)}
+}
+
+// mean returns the arithmetic mean of the values
+func mean(values []float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,96 @@
+package forecast
+
+import (
+	"math"
+
+	"microservice/structs"
+)
+
+// normalQuantile returns the quantile of the standard normal distribution for
+// the probability p. The quantile is approximated with the algorithm by Peter
+// J. Acklam which has a relative error below 1.15e-9
+func normalQuantile(p float64) float64 {
+	if p <= 0 {
+		return math.Inf(-1)
+	}
+	if p >= 1 {
+		return math.Inf(1)
+	}
+
+	a := [6]float64{-3.969683028665376e+01, 2.209460984245205e+02, -2.759285104469687e+02,
+		1.383577518672690e+02, -3.066479806614716e+01, 2.506628277459239e+00}
+	b := [5]float64{-5.447609879822406e+01, 1.615858368580409e+02, -1.556989798598866e+02,
+		6.680131188771972e+01, -1.328068155288572e+01}
+	c := [6]float64{-7.784894002430293e-03, -3.223964580411365e-01, -2.400758277161838e+00,
+		-2.549732539343734e+00, 4.374664141464968e+00, 2.938163982698783e+00}
+	d := [4]float64{7.784695709041462e-03, 3.224671290700398e-01, 2.445134137142996e+00,
+		3.754408661907416e+00}
+
+	const lowerRegion = 0.02425
+	switch {
+	case p < lowerRegion:
+		q := math.Sqrt(-2 * math.Log(p))
+		return (((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	case p > 1-lowerRegion:
+		q := math.Sqrt(-2 * math.Log(1-p))
+		return -(((((c[0]*q+c[1])*q+c[2])*q+c[3])*q+c[4])*q + c[5]) /
+			((((d[0]*q+d[1])*q+d[2])*q+d[3])*q + 1)
+	default:
+		q := p - 0.5
+		r := q * q
+		return (((((a[0]*r+a[1])*r+a[2])*r+a[3])*r+a[4])*r + a[5]) * q /
+			(((((b[0]*r+b[1])*r+b[2])*r+b[3])*r+b[4])*r + 1)
+	}
+}
+
+// normalDataPoint builds the per-person output data point for a forecast total
+// water usage with normally distributed errors. A band is added for every
+// interval width while the bounds of the data point belong to the first width
+func normalDataPoint(date string, forecast, standardError, population float64, widths []float64) structs.OutputDataPoint {
+	dataPoint := structs.OutputDataPoint{
+		Date:      date,
+		Forecast:  forecast / population,
+		Intervals: make(map[string]structs.Band),
+	}
+	for i, width := range widths {
+		z := normalQuantile((1 + width) / 2)
+		band := structs.Band{
+			LowerBound: (forecast - z*standardError) / population,
+			UpperBound: (forecast + z*standardError) / population,
+		}
+		dataPoint.Intervals[IntervalName(width)] = band
+		if i == 0 {
+			dataPoint.LowerBound, dataPoint.UpperBound = band.LowerBound, band.UpperBound
+		}
+	}
+	return dataPoint
+}
+
+// clampDataPoint limits the forecast and the bounds of the data point to the
+// range between the minimum and the maximum
+func clampDataPoint(dataPoint *structs.OutputDataPoint, minimum, maximum float64) {
+	clamp := func(value float64) float64 {
+		return math.Max(minimum, math.Min(maximum, value))
+	}
+	dataPoint.LowerBound = clamp(dataPoint.LowerBound)
+	dataPoint.Forecast = clamp(dataPoint.Forecast)
+	dataPoint.UpperBound = clamp(dataPoint.UpperBound)
+	for name, band := range dataPoint.Intervals {
+		dataPoint.Intervals[name] = structs.Band{LowerBound: clamp(band.LowerBound), UpperBound: clamp(band.UpperBound)}
+	}
+}
+
+// fittedPoint builds the comparison of a recorded total water usage with the
+// value fitted by the model. The bounds belong to the interval with the
+// supplied width and assume normally distributed errors
+func fittedPoint(date string, actual, fitted, standardError, width float64) structs.FittedPoint {
+	z := normalQuantile((1 + width) / 2)
+	return structs.FittedPoint{
+		Date:       date,
+		Actual:     actual,
+		Fitted:     fitted,
+		LowerBound: fitted - z*standardError,
+		UpperBound: fitted + z*standardError,
+	}
+}
@@ -0,0 +1,60 @@
+package forecast
+
+import (
+	"context"
+	"math"
+
+	"microservice/structs"
+)
+
+// StubForecaster is a deterministic in-process backend which does not fit a
+// model. It forecasts the mean of the recorded water usages for every year of
+// a population scenario and derives the prediction intervals from the standard
+// deviation of the recorded water usages. Since the results only depend on the input
+// data, the backend allows exercising the handlers without an R installation
+type StubForecaster struct{}
+
+// Forecast calculates the per-person water usage for every population scenario
+// contained in the input
+func (StubForecaster) Forecast(_ context.Context, input Input, options Options) (*Result, error) {
+	var sum float64
+	for _, dataPoint := range input.WaterUsages {
+		sum += dataPoint.Value
+	}
+	mean := sum / float64(len(input.WaterUsages))
+
+	var squaredDeviations float64
+	for _, dataPoint := range input.WaterUsages {
+		squaredDeviations += math.Pow(dataPoint.Value-mean, 2)
+	}
+	standardDeviation := math.Sqrt(squaredDeviations / float64(len(input.WaterUsages)))
+
+	result := &Result{Scenarios: make(map[string][]structs.OutputDataPoint)}
+	for scenario, futurePopulation := range input.PopulationScenarios {
+		population := append(append([]structs.InputDataPoint{}, input.CurrentPopulation...), futurePopulation...)
+		var dataPoints []structs.OutputDataPoint
+		for _, populationDataPoint := range population {
+			dataPoints = append(dataPoints, normalDataPoint(populationDataPoint.Date, mean, standardDeviation,
+				populationDataPoint.Value, options.intervalWidths()))
+		}
+		result.Scenarios[scenario] = dataPoints
+
+		// the stub has no seasonal or regressor effects. the mean is the trend
+		if options.IncludeComponents {
+			if result.Components == nil {
+				result.Components = make(map[string][]structs.ComponentPoint)
+			}
+			for _, populationDataPoint := range population {
+				result.Components[scenario] = append(result.Components[scenario],
+					structs.ComponentPoint{Date: populationDataPoint.Date, Trend: mean})
+			}
+		}
+	}
+	if options.IncludeFitted {
+		for _, dataPoint := range input.WaterUsages {
+			result.Fitted = append(result.Fitted, fittedPoint(dataPoint.Date, dataPoint.Value, mean,
+				standardDeviation, options.intervalWidths()[0]))
+		}
+	}
+	return result, nil
+}
@@ -3,6 +3,11 @@ package globals
 import (
 	"github.com/qustavo/dotsql"
 	wisdomType "github.com/wisdom-oss/commonTypes"
+
+	"microservice/cache"
+	"microservice/forecast"
+	"microservice/history"
+	"microservice/jobs"
 )
 
 // This file contains globally shared variables (e.g., service name, sql queries)
@@ -24,3 +29,23 @@ var Environment map[string]string = make(map[string]string)
 
 // Errors contains all errors that have been predefined in the "errors.json" file.
 var Errors map[string]wisdomType.WISdoMError = make(map[string]wisdomType.WISdoMError)
+
+// Forecasters contains all model backends available in the service. The key of
+// the mapping is the name used to select the backend via the `model` parameter
+var Forecasters map[string]forecast.Forecaster = make(map[string]forecast.Forecaster)
+
+// DefaultForecaster contains the name of the model backend which is used if a
+// request does not select a backend
+var DefaultForecaster string
+
+// Jobs contains the manager which calculates the forecast jobs submitted to the
+// service in the background
+var Jobs *jobs.Manager
+
+// Cache contains the cache in which calculated forecasts are stored. If caching
+// is disabled, the cache is nil
+var Cache cache.Cache
+
+// History contains the store in which every calculated forecast is recorded.
+// If the history is disabled, the store is nil
+var History *history.Store
@@ -0,0 +1,165 @@
+// Package history stores every calculated forecast in the database. This
+// allows reproducing a forecast which has been shown some time ago
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/qustavo/dotsql"
+
+	"microservice/forecast"
+	"microservice/structs"
+)
+
+// ErrRunNotFound is returned if there is no run with the requested id
+var ErrRunNotFound = errors.New("there is no forecast run with the supplied id")
+
+// Summary contains the information about a forecast run which is shown when
+// listing the forecast runs
+type Summary struct {
+	ID               string    `json:"id"`
+	CreatedAt        time.Time `json:"createdAt"`
+	RequestedKeys    []string  `json:"requestedKeys"`
+	MunicipalityKeys []string  `json:"municipalityKeys"`
+	Model            string    `json:"model"`
+	Runtime          float64   `json:"runtime"`
+	CacheHit         bool      `json:"cacheHit"`
+}
+
+// Run contains everything needed to reproduce a forecast run
+type Run struct {
+	Summary
+	Options forecast.Options          `json:"options"`
+	Input   forecast.Input            `json:"input"`
+	Result  *structs.ScenarioResponse `json:"result"`
+}
+
+// Filter restricts the forecast runs which are listed
+type Filter struct {
+	// Keys contains shape keys. Only runs which contain a municipality
+	// starting with one of the keys are listed. If no keys are set, the runs
+	// are not filtered by region
+	Keys []string
+
+	// From excludes all runs created before the time
+	From *time.Time
+
+	// To excludes all runs created at or after the time
+	To *time.Time
+
+	// Limit is the maximum number of runs listed
+	Limit int
+}
+
+// Store reads and writes the forecast runs from and to the database
+type Store struct {
+	db      *sql.DB
+	queries *dotsql.DotSql
+}
+
+// NewStore creates the table used for storing the forecast runs if it does not
+// exist yet and returns a store using the table
+func NewStore(db *sql.DB, queries *dotsql.DotSql) (*Store, error) {
+	for _, query := range []string{"create-forecast-schema", "create-forecast-runs-table"} {
+		_, err := queries.Exec(db, query)
+		if err != nil {
+			return nil, fmt.Errorf("unable to prepare forecast runs table: %w", err)
+		}
+	}
+	return &Store{db: db, queries: queries}, nil
+}
+
+// Save stores the run and returns the id assigned to it
+func (s *Store) Save(ctx context.Context, run Run) (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	run.ID = hex.EncodeToString(id)
+
+	options, err := json.Marshal(run.Options)
+	if err != nil {
+		return "", err
+	}
+	input, err := json.Marshal(run.Input)
+	if err != nil {
+		return "", err
+	}
+	result, err := json.Marshal(run.Result)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.queries.ExecContext(ctx, s.db, "insert-forecast-run", run.ID, pq.Array(run.RequestedKeys),
+		pq.Array(run.MunicipalityKeys), run.Model, options, input, result, run.Runtime, run.CacheHit)
+	if err != nil {
+		return "", err
+	}
+	return run.ID, nil
+}
+
+// List returns the summaries of the runs matching the filter. The most recent
+// runs are listed first
+func (s *Store) List(ctx context.Context, filter Filter) ([]Summary, error) {
+	rows, err := s.queries.QueryContext(ctx, s.db, "list-forecast-runs", pq.Array(filter.Keys), filter.From,
+		filter.To, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]Summary, 0)
+	for rows.Next() {
+		var summary Summary
+		err = rows.Scan(&summary.ID, &summary.CreatedAt, pq.Array(&summary.RequestedKeys),
+			pq.Array(&summary.MunicipalityKeys), &summary.Model, &summary.Runtime, &summary.CacheHit)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// Get returns the run with the supplied id. If there is no such run,
+// ErrRunNotFound is returned
+func (s *Store) Get(ctx context.Context, id string) (*Run, error) {
+	row, err := s.queries.QueryRowContext(ctx, s.db, "get-forecast-run", id)
+	if err != nil {
+		return nil, err
+	}
+
+	var run Run
+	var options, input, result []byte
+	err = row.Scan(&run.ID, &run.CreatedAt, pq.Array(&run.RequestedKeys), pq.Array(&run.MunicipalityKeys),
+		&run.Model, &run.Runtime, &run.CacheHit, &options, &input, &result)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(options, &run.Options)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(input, &run.Input)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(result, &run.Result)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
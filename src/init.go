@@ -5,10 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	wisdomType "github.com/wisdom-oss/commonTypes"
+	"microservice/cache"
+	"microservice/forecast"
 	"microservice/globals"
+	"microservice/history"
+	"microservice/jobs"
 	"microservice/vars"
+	"microservice/workspace"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/qustavo/dotsql"
@@ -184,6 +191,132 @@ func init() {
 	}
 }
 
+// this function sets up the model backends which are used to calculate the
+// requested forecasts and selects the default backend
+func init() {
+	l.Info().Msg("setting up forecasting backends")
+	seasonalPeriod, err := strconv.Atoi(globals.Environment["NATIVE_SEASONAL_PERIOD"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse seasonal period for native backend")
+	}
+	vars.ForecastConcurrency, err = strconv.Atoi(globals.Environment["FORECAST_CONCURRENCY"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse number of concurrent forecasts")
+	}
+	queueSize, err := strconv.Atoi(globals.Environment["FORECAST_QUEUE_SIZE"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse size of forecast queue")
+	}
+	vars.RetryAfter, err = strconv.Atoi(globals.Environment["RETRY_AFTER"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse retry interval for overloaded requests")
+	}
+	vars.ForecastTimeout, err = time.ParseDuration(globals.Environment["FORECAST_TIMEOUT"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse forecast timeout")
+	}
+	limiter := forecast.NewLimiter(vars.ForecastConcurrency, queueSize, log.With().Str("step", "forecast").Logger())
+	vars.TemporaryDataDirectory = globals.Environment["TEMPORARY_DATA_DIRECTORY"]
+	workspaces := &workspace.Manager{
+		Root:                vars.TemporaryDataDirectory,
+		QuarantineDirectory: globals.Environment["QUARANTINE_DIRECTORY"],
+		Logger:              log.With().Str("step", "workspace").Logger(),
+	}
+	rscriptForecaster, err := forecast.NewRScriptForecaster("./res/prophet.r", workspaces)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to locate prophet-based r script")
+	}
+	globals.Forecasters["prophet"] = forecast.LimitedForecaster{
+		Forecaster: rscriptForecaster,
+		Limiter:    limiter,
+	}
+	globals.Forecasters["native"] = forecast.NativeForecaster{SeasonalPeriod: seasonalPeriod}
+	stubEnabled, err := strconv.ParseBool(globals.Environment["STUB_MODEL_ENABLED"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse stub model setting")
+	}
+	if stubEnabled {
+		globals.Forecasters["stub"] = forecast.StubForecaster{}
+	}
+
+	globals.DefaultForecaster = globals.Environment["FORECAST_MODEL"]
+	if _, isSet := globals.Forecasters[globals.DefaultForecaster]; !isSet {
+		l.Fatal().Str("model", globals.DefaultForecaster).Msg("unknown default forecasting backend")
+	}
+	l.Info().Str("model", globals.DefaultForecaster).Int("concurrency", vars.ForecastConcurrency).Int("queueSize", queueSize).
+		Msg("set up forecasting backends")
+}
+
+// this function starts the manager which calculates the submitted forecast jobs
+// in the background
+func init() {
+	l.Info().Msg("starting forecast job manager")
+	workers, err := strconv.Atoi(globals.Environment["JOB_WORKERS"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse number of job workers")
+	}
+	queueSize, err := strconv.Atoi(globals.Environment["JOB_QUEUE_SIZE"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse size of job queue")
+	}
+	retention, err := time.ParseDuration(globals.Environment["JOB_RETENTION"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse retention period of finished jobs")
+	}
+	globals.Jobs = jobs.NewManager(workers, queueSize, retention, log.With().Str("step", "jobs").Logger())
+	l.Info().Int("workers", workers).Int("queueSize", queueSize).Msg("started forecast job manager")
+}
+
+// this function sets up the cache in which the calculated forecasts are stored
+func init() {
+	l.Info().Msg("setting up forecast cache")
+	backend := globals.Environment["CACHE_BACKEND"]
+	if backend == "none" {
+		l.Info().Msg("forecast cache disabled")
+		return
+	}
+	ttl, err := time.ParseDuration(globals.Environment["CACHE_TTL"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse time to live of cached forecasts")
+	}
+	maxEntries, err := strconv.Atoi(globals.Environment["CACHE_MAX_ENTRIES"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse maximum number of cached forecasts")
+	}
+	switch backend {
+	case "memory":
+		globals.Cache = cache.NewMemoryCache(ttl, maxEntries)
+	case "postgres":
+		globals.Cache, err = cache.NewPostgresCache(globals.Db, vars.SqlQueries, ttl, maxEntries)
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to set up postgres forecast cache")
+		}
+	default:
+		l.Fatal().Str("backend", backend).Msg("unknown forecast cache backend")
+	}
+	l.Info().Str("backend", backend).Str("ttl", ttl.String()).Int("maxEntries", maxEntries).
+		Msg("set up forecast cache")
+}
+
+// this function sets up the store in which every calculated forecast is
+// recorded
+func init() {
+	l.Info().Msg("setting up forecast history")
+	enabled, err := strconv.ParseBool(globals.Environment["HISTORY_ENABLED"])
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse history setting")
+	}
+	if !enabled {
+		l.Info().Msg("forecast history disabled")
+		return
+	}
+	globals.History, err = history.NewStore(globals.Db, vars.SqlQueries)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to set up forecast history")
+	}
+	l.Info().Msg("set up forecast history")
+}
+
 // this function just logs that the init process is finished
 func init() {
 	l.Info().Msg("finished initialization")
@@ -0,0 +1,211 @@
+// Package jobs contains a manager which calculates forecasts in the background.
+// This allows clients to submit a forecast and poll its status instead of
+// holding the connection open until the forecast has been calculated
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+	"microservice/vars"
+)
+
+// Status describes the state a job is currently in
+type Status string
+
+const (
+	Queued    Status = "queued"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+)
+
+// ErrQueueFull is returned if a job is submitted while the queue of the
+// manager is already full
+var ErrQueueFull = errors.New("the job queue is full")
+
+// RunFunc calculates the result of a job
+type RunFunc func(ctx context.Context) (*structs.ScenarioResponse, error)
+
+// Job contains the status information about a submitted job
+type Job struct {
+	ID          string                `json:"id"`
+	Status      Status                `json:"status"`
+	SubmittedAt time.Time             `json:"submittedAt"`
+	StartedAt   *time.Time            `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time            `json:"finishedAt,omitempty"`
+	Error       *structs.RequestError `json:"error,omitempty"`
+
+	run    RunFunc
+	result *structs.ScenarioResponse
+}
+
+// Manager stores the submitted jobs and executes them with a fixed number of
+// workers. Finished jobs are removed after the configured retention period
+type Manager struct {
+	mutex     sync.RWMutex
+	jobs      map[string]*Job
+	queue     chan *Job
+	retention time.Duration
+	logger    zerolog.Logger
+}
+
+// NewManager creates a new manager and starts its workers. At most queueSize
+// jobs may wait for a free worker at the same time
+func NewManager(workers int, queueSize int, retention time.Duration, logger zerolog.Logger) *Manager {
+	manager := &Manager{
+		jobs:      make(map[string]*Job),
+		queue:     make(chan *Job, queueSize),
+		retention: retention,
+		logger:    logger,
+	}
+	for i := 0; i < workers; i++ {
+		go manager.work()
+	}
+	go manager.cleanUp()
+	return manager
+}
+
+// Submit adds a new job to the queue of the manager and returns a copy of the
+// job. If the queue is full, ErrQueueFull is returned
+func (m *Manager) Submit(run RunFunc) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:          id,
+		Status:      Queued,
+		SubmittedAt: time.Now(),
+		run:         run,
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	select {
+	case m.queue <- job:
+		m.jobs[id] = job
+		m.logger.Info().Str("jobID", id).Int("queueDepth", len(m.queue)).Msg("queued new job")
+		return *job, nil
+	default:
+		return Job{}, ErrQueueFull
+	}
+}
+
+// Get returns a copy of the job with the supplied id. The boolean indicates if
+// the job exists
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	job, exists := m.jobs[id]
+	if !exists {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Result returns the result of a job. The result is nil if the job has not
+// succeeded (yet)
+func (j Job) Result() *structs.ScenarioResponse {
+	return j.result
+}
+
+// work executes the queued jobs until the service stops
+func (m *Manager) work() {
+	for job := range m.queue {
+		m.execute(job)
+	}
+}
+
+// execute runs a single job and stores its outcome
+func (m *Manager) execute(job *Job) {
+	startTime := time.Now()
+	m.mutex.Lock()
+	job.Status = Running
+	job.StartedAt = &startTime
+	m.mutex.Unlock()
+	m.logger.Info().Str("jobID", job.ID).Str("waitTime", startTime.Sub(job.SubmittedAt).String()).
+		Msg("started job")
+
+	result, err := job.run(context.Background())
+
+	finishTime := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job.FinishedAt = &finishTime
+	job.run = nil
+	if err != nil {
+		job.Status = Failed
+		job.Error = m.toRequestError(err)
+		m.logger.Warn().Str("jobID", job.ID).Err(err).Msg("job failed")
+		return
+	}
+	job.Status = Succeeded
+	job.result = result
+	m.logger.Info().Str("jobID", job.ID).Str("executionTime", finishTime.Sub(startTime).String()).
+		Msg("job succeeded")
+}
+
+// toRequestError returns the request error wrapped by the error. Other errors
+// are converted into an internal error containing the error message. If the
+// internal error can not be built, a static internal error is used instead
+func (m *Manager) toRequestError(err error) *structs.RequestError {
+	var requestError *structs.RequestError
+	if errors.As(err, &requestError) {
+		return requestError
+	}
+	requestError, buildError := requestErrors.BuildRequestError(requestErrors.InternalError)
+	if buildError != nil {
+		m.logger.Error().Err(buildError).Msg("unable to build request error")
+		requestError = &structs.RequestError{
+			HttpStatus:       http.StatusInternalServerError,
+			HttpError:        http.StatusText(http.StatusInternalServerError),
+			ErrorCode:        fmt.Sprintf("%s.%s", vars.ServiceName, requestErrors.InternalError),
+			ErrorTitle:       "Internal Error",
+			ErrorDescription: "During the handling of the request an unexpected error occurred",
+		}
+	}
+	requestError.ErrorDescription = requestError.ErrorDescription + ": " + err.Error()
+	return requestError
+}
+
+// cleanUp periodically removes the jobs which finished before the retention
+// period
+func (m *Manager) cleanUp() {
+	ticker := time.NewTicker(time.Minute)
+	for now := range ticker.C {
+		m.removeExpiredJobs(now)
+	}
+}
+
+// removeExpiredJobs removes the jobs which finished more than the retention
+// period before the supplied time
+func (m *Manager) removeExpiredJobs(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, job := range m.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// newJobID generates a random identifier for a job
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
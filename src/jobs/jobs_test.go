@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+)
+
+// controlledRun returns a job which signals its start and blocks until the
+// returned finish function is called with the outcome of the job
+func controlledRun() (run RunFunc, started chan struct{}, finish func(*structs.ScenarioResponse, error)) {
+	started = make(chan struct{})
+	outcome := make(chan func() (*structs.ScenarioResponse, error), 1)
+	run = func(context.Context) (*structs.ScenarioResponse, error) {
+		close(started)
+		return (<-outcome)()
+	}
+	finish = func(result *structs.ScenarioResponse, err error) {
+		outcome <- func() (*structs.ScenarioResponse, error) { return result, err }
+	}
+	return run, started, finish
+}
+
+// waitForStatus waits until the job with the id has the supplied status and
+// returns the job
+func waitForStatus(t *testing.T, manager *Manager, id string, status Status) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, exists := manager.Get(id)
+		if !exists {
+			t.Fatalf("job %s does not exist", id)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s has the status %q, want %q", id, job.Status, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagerRunsSucceedingJob(t *testing.T) {
+	manager := NewManager(1, 1, time.Hour, zerolog.Nop())
+	run, started, finish := controlledRun()
+	job, err := manager.Submit(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	running := waitForStatus(t, manager, job.ID, Running)
+	if running.StartedAt == nil || running.StartedAt.Before(running.SubmittedAt) || running.FinishedAt != nil {
+		t.Errorf("unexpected timing of the running job: %+v", running)
+	}
+	if running.Result() != nil {
+		t.Errorf("running job already has a result")
+	}
+
+	result := &structs.ScenarioResponse{}
+	finish(result, nil)
+	succeeded := waitForStatus(t, manager, job.ID, Succeeded)
+	if succeeded.FinishedAt == nil || succeeded.FinishedAt.Before(*succeeded.StartedAt) {
+		t.Errorf("unexpected timing of the finished job: %+v", succeeded)
+	}
+	if succeeded.Result() != result || succeeded.Error != nil {
+		t.Errorf("unexpected outcome of the finished job: %+v", succeeded)
+	}
+}
+
+func TestManagerQueuesJobsUntilWorkerIsFree(t *testing.T) {
+	manager := NewManager(1, 1, time.Hour, zerolog.Nop())
+	firstRun, firstStarted, finishFirst := controlledRun()
+	first, err := manager.Submit(firstRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-firstStarted
+
+	secondRun, secondStarted, finishSecond := controlledRun()
+	second, err := manager.Submit(secondRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Status != Queued {
+		t.Errorf("submitted job has the status %q, want %q", second.Status, Queued)
+	}
+	if _, err := manager.Submit(secondRun); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("got error %v, want %v", err, ErrQueueFull)
+	}
+	if queued := waitForStatus(t, manager, second.ID, Queued); queued.StartedAt != nil {
+		t.Errorf("queued job has a start time: %+v", queued)
+	}
+
+	finishFirst(&structs.ScenarioResponse{}, nil)
+	waitForStatus(t, manager, first.ID, Succeeded)
+	<-secondStarted
+	finishSecond(&structs.ScenarioResponse{}, nil)
+	waitForStatus(t, manager, second.ID, Succeeded)
+}
+
+func TestManagerStoresErrorsOfFailedJobs(t *testing.T) {
+	invalidParameter, err := requestErrors.BuildRequestError(requestErrors.InvalidParameter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name            string
+		err             error
+		wantCode        string
+		wantDescription string
+	}{
+		{"request error", invalidParameter, requestErrors.InvalidParameter, invalidParameter.ErrorDescription},
+		{"other error", errors.New("model crashed"), requestErrors.InternalError, "model crashed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := NewManager(1, 1, time.Hour, zerolog.Nop())
+			run, _, finish := controlledRun()
+			finish(nil, test.err)
+			job, err := manager.Submit(run)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failed := waitForStatus(t, manager, job.ID, Failed)
+			if failed.FinishedAt == nil || failed.Result() != nil {
+				t.Errorf("unexpected outcome of the failed job: %+v", failed)
+			}
+			if failed.Error == nil || !strings.HasSuffix(failed.Error.ErrorCode, test.wantCode) ||
+				!strings.Contains(failed.Error.ErrorDescription, test.wantDescription) {
+				t.Errorf("got error %+v, want %s containing %q", failed.Error, test.wantCode, test.wantDescription)
+			}
+		})
+	}
+}
+
+func TestManagerRemovesExpiredJobs(t *testing.T) {
+	manager := NewManager(1, 1, time.Hour, zerolog.Nop())
+	run, _, finish := controlledRun()
+	finish(&structs.ScenarioResponse{}, nil)
+	job, err := manager.Submit(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := waitForStatus(t, manager, job.ID, Succeeded)
+
+	unfinishedRun, unfinishedStarted, finishUnfinished := controlledRun()
+	defer finishUnfinished(nil, nil)
+	unfinished, err := manager.Submit(unfinishedRun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-unfinishedStarted
+
+	manager.removeExpiredJobs(finished.FinishedAt.Add(time.Hour))
+	if _, exists := manager.Get(job.ID); !exists {
+		t.Errorf("job has been removed before the end of the retention period")
+	}
+
+	manager.removeExpiredJobs(finished.FinishedAt.Add(time.Hour + time.Second))
+	if _, exists := manager.Get(job.ID); exists {
+		t.Errorf("job has not been removed after the retention period")
+	}
+	if _, exists := manager.Get(unfinished.ID); !exists {
+		t.Errorf("unfinished job has been removed")
+	}
+}
@@ -11,6 +11,27 @@ const InsufficientScope = "INSUFFICIENT_SCOPE"
 const InternalError = "INTERNAL_ERROR"
 const MissingShapeKeys = "NO_SHAPE_KEYS"
 const NoWaterUsageData = "NO_WATER_USAGE_DATA"
+const UnknownModel = "UNKNOWN_MODEL"
+const JobQueueFull = "JOB_QUEUE_FULL"
+const JobNotFound = "JOB_NOT_FOUND"
+const JobNotFinished = "JOB_NOT_FINISHED"
+const ForecastQueueFull = "FORECAST_QUEUE_FULL"
+const ForecastTimeout = "FORECAST_TIMEOUT"
+const TooFewDataPoints = "TOO_FEW_DATA_POINTS"
+const SeriesLengthMismatch = "SERIES_LENGTH_MISMATCH"
+const ModelDependencyMissing = "MODEL_DEPENDENCY_MISSING"
+const ModelExecutionFailed = "MODEL_EXECUTION_FAILED"
+const InvalidParameter = "INVALID_PARAMETER"
+const RunNotFound = "RUN_NOT_FOUND"
+const NoPopulationPrognosis = "NO_POPULATION_PROGNOSIS"
+const UnsupportedModelOption = "UNSUPPORTED_MODEL_OPTION"
+const InvalidRequestBody = "INVALID_REQUEST_BODY"
+const DataGaps = "DATA_GAPS"
+
+// retryableErrors contains the errors which are sent back if the service is
+// currently overloaded. Responses containing these errors ask the client to
+// retry the request later
+var retryableErrors = []string{JobQueueFull, ForecastQueueFull}
 
 var titles = map[string]string{
 	MissingAuthorizationInformation: "Unauthorized",
@@ -18,6 +39,22 @@ var titles = map[string]string{
 	InternalError:                   "Internal Error",
 	MissingShapeKeys:                "No Shape Keys",
 	NoWaterUsageData:                "No Water Usage Data",
+	UnknownModel:                    "Unknown Model",
+	JobQueueFull:                    "Job Queue Full",
+	JobNotFound:                     "Job Not Found",
+	JobNotFinished:                  "Job Not Finished",
+	ForecastQueueFull:               "Forecast Queue Full",
+	ForecastTimeout:                 "Forecast Timeout",
+	TooFewDataPoints:                "Too Few Data Points",
+	SeriesLengthMismatch:            "Series Length Mismatch",
+	ModelDependencyMissing:          "Model Dependency Missing",
+	ModelExecutionFailed:            "Model Execution Failed",
+	InvalidParameter:                "Invalid Parameter",
+	RunNotFound:                     "Run Not Found",
+	NoPopulationPrognosis:           "No Population Prognosis",
+	UnsupportedModelOption:          "Unsupported Model Option",
+	InvalidRequestBody:              "Invalid Request Body",
+	DataGaps:                        "Gaps In Recorded Data",
 }
 
 var descriptions = map[string]string{
@@ -29,6 +66,22 @@ var descriptions = map[string]string{
 	MissingShapeKeys: "The request did not contain any shape keys",
 	NoWaterUsageData: "The request was formed correctly, " +
 		"but there are no water usage datasets available for the selected areas",
+	UnknownModel:           "The requested model is not available in this service",
+	JobQueueFull:           "The service is currently processing too many forecast jobs. Please try again later",
+	JobNotFound:            "There is no forecast job with the supplied id. Finished jobs are removed after some time",
+	JobNotFinished:         "The forecast job has not finished yet. Please poll the status of the job until it has finished",
+	ForecastQueueFull:      "The service is currently calculating too many forecasts. Please try again later",
+	ForecastTimeout:        "The forecast could not be calculated within the configured time limit",
+	TooFewDataPoints:       "The water usage series of the selected areas contains too few data points to fit the model",
+	SeriesLengthMismatch:   "The population series of the selected areas do not match the length of the water usage forecast",
+	ModelDependencyMissing: "A dependency of the selected model is not installed. Please try another model or contact the administrator",
+	ModelExecutionFailed:   "The selected model failed to calculate the forecast",
+	InvalidParameter:       "The request contains an invalid parameter value",
+	RunNotFound:            "There is no forecast run with the supplied id",
+	NoPopulationPrognosis:  "The request was formed correctly, but there is no population prognosis available for the selected areas",
+	UnsupportedModelOption: "The selected model backend is not able to apply the requested model options",
+	InvalidRequestBody:     "The body of the request could not be parsed",
+	DataGaps:               "The recorded water usages or the recorded population of the selected areas contain gaps which are rejected by the gap policy",
 }
 
 var httpCodes = map[string]int{
@@ -37,4 +90,20 @@ var httpCodes = map[string]int{
 	InternalError:                   http.StatusInternalServerError,
 	MissingShapeKeys:                http.StatusBadRequest,
 	NoWaterUsageData:                http.StatusServiceUnavailable,
+	UnknownModel:                    http.StatusBadRequest,
+	JobQueueFull:                    http.StatusServiceUnavailable,
+	JobNotFound:                     http.StatusNotFound,
+	JobNotFinished:                  http.StatusConflict,
+	ForecastQueueFull:               http.StatusServiceUnavailable,
+	ForecastTimeout:                 http.StatusGatewayTimeout,
+	TooFewDataPoints:                http.StatusUnprocessableEntity,
+	SeriesLengthMismatch:            http.StatusUnprocessableEntity,
+	ModelDependencyMissing:          http.StatusServiceUnavailable,
+	ModelExecutionFailed:            http.StatusInternalServerError,
+	InvalidParameter:                http.StatusBadRequest,
+	RunNotFound:                     http.StatusNotFound,
+	NoPopulationPrognosis:           http.StatusServiceUnavailable,
+	UnsupportedModelOption:          http.StatusUnprocessableEntity,
+	InvalidRequestBody:              http.StatusBadRequest,
+	DataGaps:                        http.StatusUnprocessableEntity,
 }
@@ -2,12 +2,15 @@ package requestErrors
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"microservice/structs"
 	"microservice/utils"
 	"microservice/vars"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // BuildRequestError creates a RequestError which can be sent in case of an error which has been triggered.
@@ -33,6 +36,11 @@ func BuildRequestError(code string) (*structs.RequestError, error) {
 func RespondWithRequestError(requestError *structs.RequestError, responseWriter http.ResponseWriter) {
 	// Set the content type of the response to "text/json"
 	responseWriter.Header().Set("Content-Type", "text/json")
+	// Ask the client to retry the request later if the service is overloaded
+	errorCode := strings.TrimPrefix(requestError.ErrorCode, vars.ServiceName+".")
+	if utils.ArrayContains(retryableErrors, errorCode) {
+		responseWriter.Header().Set("Retry-After", strconv.Itoa(vars.RetryAfter))
+	}
 	// Write the http status of the request error to the response
 	responseWriter.WriteHeader(requestError.HttpStatus)
 	// Now encode the request error to json and write it to the response
@@ -52,3 +60,15 @@ func RespondWithInternalError(reason error, responseWriter http.ResponseWriter)
 	// Now send the response
 	RespondWithRequestError(requestError, responseWriter)
 }
+
+// RespondWithError responds with the supplied error. If the error is a request
+// error, it is sent back directly. Every other error is sent back as Internal
+// Server Error
+func RespondWithError(err error, responseWriter http.ResponseWriter) {
+	var requestError *structs.RequestError
+	if errors.As(err, &requestError) {
+		RespondWithRequestError(requestError, responseWriter)
+		return
+	}
+	RespondWithInternalError(err, responseWriter)
+}
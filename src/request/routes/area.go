@@ -0,0 +1,439 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+
+	"microservice/forecast"
+	"microservice/globals"
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+	"microservice/utils"
+	"microservice/vars"
+)
+
+// areaData contains the series pulled from the database for a set of
+// municipalities which are forecast together
+type areaData struct {
+	// WaterUsages contains the recorded water usages of the municipalities
+	WaterUsages []structs.InputDataPoint
+
+	// CurrentPopulation contains the recorded population of the
+	// municipalities starting with the first year of the water usages
+	CurrentPopulation []structs.InputDataPoint
+
+	// MigrationLevels contains the migration levels of the population
+	// prognosis in the order of their declaration
+	MigrationLevels []string
+
+	// PopulationScenarios contains the population prognosis of every
+	// migration level
+	PopulationScenarios map[string][]structs.InputDataPoint
+
+	// FirstForecastYear is the first year after the recorded water usages
+	FirstForecastYear int
+
+	// LastPrognosisYear is the last year contained in the population
+	// prognosis of every migration level
+	LastPrognosisYear int
+
+	// Outliers describes the outliers detected in the water usages. It is
+	// only set if the detection has been requested
+	Outliers *structs.OutlierReport
+
+	// DataQuality describes the gaps found while joining the water usages and
+	// the population by year
+	DataQuality *structs.DataQuality
+}
+
+// resolveMunicipalityKeys returns the keys of the municipalities which belong
+// to the areas selected by the shape keys
+func resolveMunicipalityKeys(ctx context.Context, logger zerolog.Logger, shapeKeys []string) ([]string, error) {
+	// now build a regex which matches any key and their possible children in the database
+	shapeKeyRegEx := "("
+	for _, shapeKey := range shapeKeys {
+		if len(shapeKey) < 12 {
+			missingNums := 12 - len(shapeKey)
+			shapeKeyRegEx += fmt.Sprintf(`%s\d{%d}|`, shapeKey, missingNums)
+		} else {
+			shapeKeyRegEx += fmt.Sprintf(`%s|`, shapeKey)
+		}
+	}
+	shapeKeyRegEx = strings.Trim(shapeKeyRegEx, "|")
+	shapeKeyRegEx += ")"
+
+	logger.Info().Msg("getting municipality keys")
+	// now query the database for the municipal keys matching the query
+	shapeKeyRows, queryError := vars.SqlQueries.QueryContext(ctx, globals.Db, "get-full-municipality-keys", shapeKeyRegEx)
+	if queryError != nil {
+		return nil, queryError
+	}
+	defer shapeKeyRows.Close()
+
+	// now iterate through the query response and put the municipality keys into an array
+	var municipalityKeys []string
+
+	for shapeKeyRows.Next() {
+		var municipalityKey string
+		scanError := shapeKeyRows.Scan(&municipalityKey)
+
+		if scanError != nil {
+			return nil, scanError
+		}
+
+		municipalityKeys = append(municipalityKeys, municipalityKey)
+	}
+	if err := shapeKeyRows.Err(); err != nil {
+		return nil, err
+	}
+	return municipalityKeys, nil
+}
+
+// pullAreaData pulls the water usages, the current population and the
+// population prognosis of the municipalities from the database. The recorded
+// data is restricted like in pullRecordedData
+func pullAreaData(ctx context.Context, logger zerolog.Logger, municipalityKeys []string,
+	parameters forecastParameters) (*areaData, error) {
+	data, err := pullRecordedData(ctx, logger, municipalityKeys, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	// now discover the migration levels of the population prognosis which are
+	// available for the selected areas
+	logger.Info().Msg("getting migration levels")
+	data.MigrationLevels, err = getMigrationLevels(ctx, municipalityKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.MigrationLevels) == 0 {
+		return nil, buildRequestError(requestErrors.NoPopulationPrognosis)
+	}
+
+	lastPopulationYear := data.FirstForecastYear - 1
+	if len(data.CurrentPopulation) > 0 {
+		lastPopulationYear, err = data.CurrentPopulation[len(data.CurrentPopulation)-1].Year()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// now get the predicted population data for every migration level from the database
+	for _, migrationLevel := range data.MigrationLevels {
+		logger.Info().Str("migrationLevel", migrationLevel).Msg("pulling future population data")
+		populationRows, queryError := vars.SqlQueries.QueryContext(ctx, globals.Db,
+			"get-future-population", pq.Array(municipalityKeys), migrationLevel)
+		if queryError != nil {
+			return nil, queryError
+		}
+		populationData, err := utils.ReadDataForProphet(populationRows)
+		if err != nil {
+			return nil, err
+		}
+		data.PopulationScenarios[migrationLevel] = populationData
+	}
+
+	// now determine the last year which may be forecast. the forecast may not
+	// exceed the population prognosis since the population is needed to
+	// calculate the per-person usage. the recorded population may run ahead of
+	// the prognosis and extends the forecast in that case
+	for _, populationData := range data.PopulationScenarios {
+		if len(populationData) == 0 {
+			return nil, buildRequestError(requestErrors.NoPopulationPrognosis)
+		}
+		lastYear, err := populationData[len(populationData)-1].Year()
+		if err != nil {
+			return nil, err
+		}
+		if lastYear < lastPopulationYear {
+			lastYear = lastPopulationYear
+		}
+		if data.LastPrognosisYear == 0 || lastYear < data.LastPrognosisYear {
+			data.LastPrognosisYear = lastYear
+		}
+	}
+
+	// the years between the recorded population and the population prognosis
+	// are missing from the forecast. if the population recorded after the
+	// as-of year has been ignored, the prognosis needs to start right after
+	// the remaining population
+	firstPrognosisYear := 0
+	for _, populationData := range data.PopulationScenarios {
+		followingData, err := windowSeries(populationData, lastPopulationYear+1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(followingData) == 0 {
+			continue
+		}
+		firstYear, err := followingData[0].Year()
+		if err != nil {
+			return nil, err
+		}
+		if firstYear > firstPrognosisYear {
+			firstPrognosisYear = firstYear
+		}
+	}
+	if firstPrognosisYear > lastPopulationYear+1 {
+		if parameters.AsOf != 0 {
+			return nil, invalidParameter("asOf", fmt.Sprintf(
+				"the population prognosis starts in %d and needs to follow the recorded population",
+				firstPrognosisYear))
+		}
+		forecast.AddPrognosisGapWarning(data.DataQuality, lastPopulationYear, firstPrognosisYear)
+	}
+	return data, nil
+}
+
+// pullRecordedData pulls the water usages and the current population of the
+// municipalities from the database. The population prognosis is not pulled. The
+// water usages are restricted to the usage types and the training window of
+// the parameters and are cleaned from outliers if requested. The population
+// recorded after the as-of year is ignored
+func pullRecordedData(ctx context.Context, logger zerolog.Logger, municipalityKeys []string,
+	parameters forecastParameters) (*areaData, error) {
+	data := &areaData{PopulationScenarios: make(map[string][]structs.InputDataPoint)}
+
+	// now prepare to get the water usage data from the database
+	logger.Info().Strs("usageTypes", parameters.UsageTypes).Msg("pulling water usage data")
+	var waterUsageRows *sql.Rows
+	var queryError error
+	if len(parameters.UsageTypes) > 0 {
+		waterUsageRows, queryError = vars.SqlQueries.QueryContext(ctx, globals.Db, "get-water-usages-by-type",
+			pq.Array(municipalityKeys), pq.Array(parameters.UsageTypes))
+	} else {
+		waterUsageRows, queryError = vars.SqlQueries.QueryContext(ctx, globals.Db, "get-water-usages",
+			pq.Array(municipalityKeys))
+	}
+	if queryError != nil {
+		return nil, queryError
+	}
+	waterUsages, err := utils.ReadDataForProphet(waterUsageRows)
+	if err != nil {
+		return nil, err
+	}
+	data.WaterUsages, err = windowSeries(waterUsages, parameters.From, parameters.lastTrainingYear())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(waterUsages) == 0 {
+		// no water usage records have been found. send an error
+		return nil, buildRequestError(requestErrors.NoWaterUsageData)
+	}
+	if len(data.WaterUsages) == 0 {
+		return nil, emptyWindowError(waterUsages, parameters)
+	}
+
+	// now determine the first year of the water usage data to determine the first year of population data needed
+	datasetStartYear := strings.Split(data.WaterUsages[0].Date, "-")[0]
+
+	// now get the current population data from the database
+	logger.Info().Msg("pulling current population data")
+	currentPopulationRows, queryError := vars.SqlQueries.QueryContext(ctx, globals.Db, "get-current-population",
+		pq.Array(municipalityKeys),
+		datasetStartYear)
+	if queryError != nil {
+		return nil, queryError
+	}
+	currentPopulation, err := utils.ReadDataForProphet(currentPopulationRows)
+	if err != nil {
+		return nil, err
+	}
+	data.CurrentPopulation, err = windowSeries(currentPopulation, 0, parameters.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// now determine the first year after the recorded water usages
+	data.FirstForecastYear, err = data.WaterUsages[len(data.WaterUsages)-1].Year()
+	if err != nil {
+		return nil, err
+	}
+	data.FirstForecastYear++
+
+	// now join the water usages and the population by year. the forecast
+	// still starts after the last recorded year if the year has been dropped
+	data.WaterUsages, data.CurrentPopulation, data.DataQuality, err = forecast.AlignSeries(data.WaterUsages,
+		data.CurrentPopulation, parameters.GapPolicy)
+	if err != nil {
+		return nil, translateForecastError(err)
+	}
+	for _, warning := range data.DataQuality.Warnings {
+		logger.Warn().Str("code", warning.Code).Ints("years", warning.Years).Msg(warning.Message)
+	}
+	if len(data.WaterUsages) == 0 {
+		return nil, translateForecastError(forecast.ErrTooFewDataPoints)
+	}
+
+	// now clean the water usages from outliers. the forecast still starts
+	// after the last recorded year if the year has been dropped
+	if parameters.Outliers != nil {
+		data.WaterUsages, data.Outliers, err = forecast.CleanOutliers(data.WaterUsages, data.CurrentPopulation,
+			*parameters.Outliers)
+		if err != nil {
+			return nil, err
+		}
+		if len(data.Outliers.Outliers) > 0 {
+			logger.Info().Int("outliers", len(data.Outliers.Outliers)).Str("action", parameters.Outliers.Action).
+				Msg("detected outliers in water usages")
+		}
+	}
+	return data, nil
+}
+
+// prepareForecast builds the input and the options of a forecast which ends
+// with the supplied year. The recorded population is truncated to the last
+// year and the population prognosis is restricted to the years between the
+// truncated recorded population and the last year. The recorded population
+// takes precedence over the prognosis of the same years. The model options
+// depending on the water usages are validated
+func prepareForecast(data *areaData, parameters forecastParameters, until int) (forecast.Input, forecast.Options,
+	error) {
+	var input forecast.Input
+	var options forecast.Options
+
+	if until < data.FirstForecastYear || until > data.LastPrognosisYear {
+		reason := fmt.Sprintf("the forecast needs to end between %d and %d", data.FirstForecastYear,
+			data.LastPrognosisYear)
+		switch {
+		case parameters.Until != 0:
+			return input, options, invalidParameter("until", reason)
+		case parameters.Horizon != 0:
+			return input, options, invalidParameter("horizon", reason)
+		}
+		// the forecast ends with the population prognosis by default, so the
+		// prognosis ends before the first year which may be forecast
+		return input, options, buildRequestErrorWithDetails(requestErrors.NoPopulationPrognosis, fmt.Sprintf(
+			"the population prognosis ends with %d before the forecast starts with %d", data.LastPrognosisYear,
+			data.FirstForecastYear))
+	}
+	currentPopulation, err := windowSeries(data.CurrentPopulation, 0, until)
+	if err != nil {
+		return input, options, err
+	}
+	lastPopulationYear := data.FirstForecastYear - 1
+	if len(currentPopulation) > 0 {
+		lastPopulationYear, err = currentPopulation[len(currentPopulation)-1].Year()
+		if err != nil {
+			return input, options, err
+		}
+	}
+	populationScenarios := make(map[string][]structs.InputDataPoint)
+	for scenario, populationData := range data.PopulationScenarios {
+		windowedData, err := windowSeries(populationData, lastPopulationYear+1, until)
+		if err != nil {
+			return input, options, err
+		}
+		populationScenarios[scenario] = windowedData
+	}
+
+	// now check the model options which depend on the water usage series. the
+	// changepoints need to lie within the series and a cap needs to exceed the
+	// recorded water usages
+	firstUsageYear, err := data.WaterUsages[0].Year()
+	if err != nil {
+		return input, options, err
+	}
+	for _, changepoint := range parameters.ModelOptions.Changepoints {
+		if changepoint <= firstUsageYear || changepoint >= data.FirstForecastYear {
+			return input, options, invalidParameter("changepoint", fmt.Sprintf(
+				"the changepoints need to lie between %d and %d", firstUsageYear+1, data.FirstForecastYear-1))
+		}
+	}
+	if parameters.ModelOptions.Cap != nil {
+		for _, dataPoint := range data.WaterUsages {
+			if dataPoint.Value >= *parameters.ModelOptions.Cap {
+				return input, options, invalidParameter("cap", "the cap needs to exceed the recorded water usages")
+			}
+		}
+	}
+
+	input = forecast.Input{
+		WaterUsages:         data.WaterUsages,
+		CurrentPopulation:   currentPopulation,
+		PopulationScenarios: populationScenarios,
+	}
+	options = forecast.Options{
+		RequestID:      parameters.RequestID,
+		Horizon:        until - data.FirstForecastYear + 1,
+		IntervalWidths: parameters.IntervalWidths,
+		Model:          parameters.ModelOptions,
+	}
+	return input, options, nil
+}
+
+// getMigrationLevels returns the migration levels of the population prognosis
+// which are available for the municipalities in the order of their declaration
+func getMigrationLevels(ctx context.Context, municipalityKeys []string) ([]string, error) {
+	rows, err := vars.SqlQueries.QueryContext(ctx, globals.Db, "get-migration-levels", pq.Array(municipalityKeys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var migrationLevels []string
+	for rows.Next() {
+		var migrationLevel string
+		if err := rows.Scan(&migrationLevel); err != nil {
+			return nil, err
+		}
+		migrationLevels = append(migrationLevels, migrationLevel)
+	}
+	return migrationLevels, rows.Err()
+}
+
+// trainingWindow returns the training window of the water usages. The window
+// contains the first and the last year of the water usages the model is fitted on
+func (d *areaData) trainingWindow(asOf int) (*structs.TrainingWindow, error) {
+	firstYear, err := d.WaterUsages[0].Year()
+	if err != nil {
+		return nil, err
+	}
+	return &structs.TrainingWindow{From: firstYear, To: d.FirstForecastYear - 1, AsOf: asOf}, nil
+}
+
+// windowSeries removes all data points before the first year and after the
+// last year from the series. A year of zero does not restrict the series
+func windowSeries(series []structs.InputDataPoint, firstYear, lastYear int) ([]structs.InputDataPoint, error) {
+	var windowedSeries []structs.InputDataPoint
+	for _, dataPoint := range series {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, err
+		}
+		if (firstYear == 0 || year >= firstYear) && (lastYear == 0 || year <= lastYear) {
+			windowedSeries = append(windowedSeries, dataPoint)
+		}
+	}
+	return windowedSeries, nil
+}
+
+// emptyWindowError builds the request error for a training window which does
+// not contain any of the recorded water usages. The error names the parameter
+// which moved the window out of the recorded years
+func emptyWindowError(waterUsages []structs.InputDataPoint, parameters forecastParameters) error {
+	firstYear, err := waterUsages[0].Year()
+	if err != nil {
+		return err
+	}
+	lastYear, err := waterUsages[len(waterUsages)-1].Year()
+	if err != nil {
+		return err
+	}
+	name := "asOf"
+	switch {
+	case parameters.From > lastYear:
+		name = "from"
+	case parameters.To != 0:
+		name = "to"
+	}
+	return invalidParameter(name, fmt.Sprintf(
+		"the window does not contain any water usages, which have been recorded from %d until %d",
+		firstYear, lastYear))
+}
@@ -0,0 +1,125 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"microservice/structs"
+)
+
+// series builds an annual series with the supplied values starting with the
+// first year
+func series(firstYear int, values ...float64) []structs.InputDataPoint {
+	var dataPoints []structs.InputDataPoint
+	for index, value := range values {
+		dataPoints = append(dataPoints, structs.InputDataPoint{
+			Date:  fmt.Sprintf("%d-12-31", firstYear+index),
+			Value: value,
+		})
+	}
+	return dataPoints
+}
+
+// years returns the years of the data points in a series
+func years(t *testing.T, dataPoints []structs.InputDataPoint) []int {
+	t.Helper()
+	var seriesYears []int
+	for _, dataPoint := range dataPoints {
+		year, err := dataPoint.Year()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seriesYears = append(seriesYears, year)
+	}
+	return seriesYears
+}
+
+func TestPrepareForecastTruncatesPopulation(t *testing.T) {
+	// the water usages end with 2020 while the population has been recorded
+	// until 2023 and the prognosis starts with 2022
+	data := &areaData{
+		WaterUsages:       series(2016, 100, 101, 102, 103, 104),
+		CurrentPopulation: series(2016, 10, 10, 10, 10, 10, 11, 11, 11),
+		PopulationScenarios: map[string][]structs.InputDataPoint{
+			"medium": series(2022, 12, 12, 13, 13, 14, 14),
+		},
+		FirstForecastYear: 2021,
+		LastPrognosisYear: 2027,
+	}
+
+	tests := []struct {
+		name           string
+		until          int
+		lastPopulation int
+		prognosis      []int
+	}{
+		{"before the end of the recorded population", 2022, 2022, nil},
+		{"at the end of the recorded population", 2023, 2023, nil},
+		{"after the end of the recorded population", 2025, 2023, []int{2024, 2025}},
+		{"at the end of the prognosis", 2027, 2023, []int{2024, 2025, 2026, 2027}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input, options, err := prepareForecast(data, forecastParameters{}, test.until)
+			if err != nil {
+				t.Fatal(err)
+			}
+			populationYears := years(t, input.CurrentPopulation)
+			if last := populationYears[len(populationYears)-1]; last != test.lastPopulation {
+				t.Errorf("recorded population ends with %d, want %d", last, test.lastPopulation)
+			}
+			prognosisYears := years(t, input.PopulationScenarios["medium"])
+			if fmt.Sprint(prognosisYears) != fmt.Sprint(test.prognosis) {
+				t.Errorf("prognosis covers %v, want %v", prognosisYears, test.prognosis)
+			}
+			if want := test.until - data.FirstForecastYear + 1; options.Horizon != want {
+				t.Errorf("horizon is %d, want %d", options.Horizon, want)
+			}
+		})
+	}
+}
+
+func TestPrepareForecastRejectsUntilOutsideOfPrognosis(t *testing.T) {
+	data := &areaData{
+		WaterUsages:       series(2016, 100, 101, 102, 103, 104),
+		CurrentPopulation: series(2016, 10, 10, 10, 10, 10),
+		PopulationScenarios: map[string][]structs.InputDataPoint{
+			"medium": series(2021, 12, 12, 13),
+		},
+		FirstForecastYear: 2021,
+		LastPrognosisYear: 2023,
+	}
+	for _, until := range []int{2020, 2024} {
+		_, _, err := prepareForecast(data, forecastParameters{Until: until}, until)
+		if err == nil || !strings.Contains(err.Error(), "INVALID_PARAMETER") ||
+			!strings.Contains(err.Error(), "until: ") {
+			t.Errorf("got error %v for the forecast until %d, want the parameter to be rejected", err, until)
+		}
+	}
+	_, _, err := prepareForecast(data, forecastParameters{Horizon: 4}, 2024)
+	if err == nil || !strings.Contains(err.Error(), "horizon: ") {
+		t.Errorf("got error %v for the horizon, want the parameter to be rejected", err)
+	}
+}
+
+func TestPrepareForecastRejectsPrognosisBeforeForecast(t *testing.T) {
+	// the population prognosis ends before the water usages. without until
+	// and horizon the forecast ends with the prognosis
+	data := &areaData{
+		WaterUsages:       series(2016, 100, 101, 102, 103, 104),
+		CurrentPopulation: series(2016, 10, 10, 10, 10, 10),
+		PopulationScenarios: map[string][]structs.InputDataPoint{
+			"medium": series(2017, 12, 12, 13),
+		},
+		FirstForecastYear: 2021,
+		LastPrognosisYear: 2020,
+	}
+	_, _, err := prepareForecast(data, forecastParameters{}, data.LastPrognosisYear)
+	if err == nil || !strings.Contains(err.Error(), "NO_POPULATION_PROGNOSIS") {
+		t.Fatalf("got error %v, want a missing population prognosis", err)
+	}
+	if strings.Contains(err.Error(), "until") || strings.Contains(err.Error(), "horizon") {
+		t.Errorf("error %q names a parameter which has not been sent", err)
+	}
+}
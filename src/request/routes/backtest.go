@@ -0,0 +1,251 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"microservice/forecast"
+	"microservice/globals"
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+	"microservice/utils"
+	"microservice/vars"
+)
+
+// maximumCutoffs is the maximum number of cutoff years which may be backtested
+// in a single request
+const maximumCutoffs = 10
+
+// recordedScenario is the name of the population scenario which contains the
+// recorded population of the held-out years during a backtest
+const recordedScenario = "recorded"
+
+/*
+BacktestRequest
+
+This handler evaluates the accuracy of the selected model for the areas selected
+in the request. For every cutoff year, the model is fitted on the water usages
+recorded until the cutoff year and the forecast of the following years is
+compared to the recorded water usages. The forecast uses the recorded
+population of the held-out years
+*/
+func BacktestRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	parameters, err := parseForecastParameters(request)
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+
+	var cutoffs []int
+	for _, rawCutoff := range queryParameters(request, "cutoff") {
+		cutoff, err := strconv.Atoi(rawCutoff)
+		if err != nil {
+			requestErrors.RespondWithError(invalidParameter("cutoff", "expected a year"), responseWriter)
+			return
+		}
+		if !utils.ArrayContains(cutoffs, cutoff) {
+			cutoffs = append(cutoffs, cutoff)
+		}
+	}
+	if len(cutoffs) == 0 || len(cutoffs) > maximumCutoffs {
+		requestErrors.RespondWithError(invalidParameter("cutoff", fmt.Sprintf(
+			"expected between 1 and %d cutoff years", maximumCutoffs)), responseWriter)
+		return
+	}
+	sort.Ints(cutoffs)
+
+	result, err := calculateBacktest(request.Context(), *parameters, cutoffs)
+	if errors.Is(request.Context().Err(), context.Canceled) {
+		vars.HttpLogger.Info().Str("requestID", parameters.RequestID).Msg("client disconnected. cancelled backtest")
+		return
+	}
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	encodingError := json.NewEncoder(responseWriter).Encode(result)
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
+
+// calculateBacktest pulls the recorded data of the selected areas and
+// backtests the model for every cutoff year. The backtest is cancelled if the
+// context is cancelled or the configured forecast timeout is exceeded
+func calculateBacktest(ctx context.Context, parameters forecastParameters, cutoffs []int) (
+	result *structs.BacktestResult, err error) {
+	logger := vars.HttpLogger.With().Str("requestID", parameters.RequestID).Logger()
+
+	ctx, cancel := context.WithTimeout(ctx, vars.ForecastTimeout)
+	defer cancel()
+	defer func() {
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logger.Warn().Err(err).Str("timeout", vars.ForecastTimeout.String()).Msg("backtest timed out")
+			result, err = nil, buildRequestError(requestErrors.ForecastTimeout)
+		}
+	}()
+
+	municipalityKeys, err := resolveMunicipalityKeys(ctx, logger, parameters.ShapeKeys)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUsageTypes(ctx, municipalityKeys, parameters.UsageTypes); err != nil {
+		return nil, err
+	}
+	data, err := pullRecordedData(ctx, logger, municipalityKeys, parameters)
+	if err != nil {
+		return nil, err
+	}
+	trainingWindow, err := data.trainingWindow(parameters.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	lastUsageYear := data.FirstForecastYear - 1
+	for _, cutoff := range cutoffs {
+		if cutoff >= lastUsageYear {
+			return nil, invalidParameter("cutoff", fmt.Sprintf("the cutoff years need to be before %d",
+				lastUsageYear))
+		}
+	}
+
+	result = &structs.BacktestResult{
+		Metadata: &structs.Metadata{
+			Model:          parameters.Model,
+			IntervalWidths: parameters.IntervalWidths,
+			ModelOptions:   &parameters.ModelOptions,
+			UsageTypes:     parameters.UsageTypes,
+			TrainingWindow: trainingWindow,
+			Outliers:       data.Outliers,
+			DataQuality:    data.DataQuality,
+		},
+	}
+	var allComparisons []forecast.Comparison
+	for _, cutoff := range cutoffs {
+		cutoffLogger := logger.With().Int("cutoff", cutoff).Logger()
+		comparisons, err := backtestCutoff(ctx, parameters, data, cutoff)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			cutoffLogger.Warn().Err(err).Msg("unable to backtest cutoff")
+			result.Cutoffs = append(result.Cutoffs, structs.BacktestCutoff{
+				Cutoff: cutoff,
+				Error:  toRequestError(cutoffLogger, err),
+			})
+			continue
+		}
+
+		metrics := forecast.Accuracy(comparisons)
+		backtest := structs.BacktestCutoff{Cutoff: cutoff, Metrics: &metrics}
+		for _, comparison := range comparisons {
+			backtest.Points = append(backtest.Points, structs.BacktestPoint{
+				Date:       comparison.Forecast.Date,
+				Actual:     comparison.Actual,
+				Forecast:   comparison.Forecast.Forecast,
+				LowerBound: comparison.Forecast.LowerBound,
+				UpperBound: comparison.Forecast.UpperBound,
+			})
+		}
+		result.Cutoffs = append(result.Cutoffs, backtest)
+		allComparisons = append(allComparisons, comparisons...)
+	}
+
+	overall := forecast.Accuracy(allComparisons)
+	result.Overall = &overall
+	return result, nil
+}
+
+// backtestCutoff fits the model on the water usages recorded until the cutoff
+// year and compares the forecast of the following years with the recorded
+// per-person water usages
+func backtestCutoff(ctx context.Context, parameters forecastParameters, data *areaData, cutoff int) (
+	[]forecast.Comparison, error) {
+	trainingUsages, err := windowSeries(data.WaterUsages, 0, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if len(trainingUsages) == 0 {
+		return nil, translateForecastError(forecast.ErrTooFewDataPoints)
+	}
+	trainingPopulation, err := windowSeries(data.CurrentPopulation, 0, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	// the recorded population of the held-out years is used as the only
+	// population scenario of the forecast
+	populationByYear := make(map[int]float64)
+	var heldOutPopulation []structs.InputDataPoint
+	for _, dataPoint := range data.CurrentPopulation {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, err
+		}
+		if year > cutoff && year < data.FirstForecastYear {
+			heldOutPopulation = append(heldOutPopulation, dataPoint)
+			populationByYear[year] = dataPoint.Value
+		}
+	}
+	if len(heldOutPopulation) == 0 {
+		return nil, translateForecastError(forecast.ErrSeriesLengthMismatch)
+	}
+	lastHeldOutYear, err := heldOutPopulation[len(heldOutPopulation)-1].Year()
+	if err != nil {
+		return nil, err
+	}
+
+	lastTrainingYear, err := trainingUsages[len(trainingUsages)-1].Year()
+	if err != nil {
+		return nil, err
+	}
+	cutoffData := &areaData{
+		WaterUsages:         trainingUsages,
+		CurrentPopulation:   trainingPopulation,
+		MigrationLevels:     []string{recordedScenario},
+		PopulationScenarios: map[string][]structs.InputDataPoint{recordedScenario: heldOutPopulation},
+		FirstForecastYear:   lastTrainingYear + 1,
+		LastPrognosisYear:   lastHeldOutYear,
+	}
+	input, options, err := prepareForecast(cutoffData, parameters, lastHeldOutYear)
+	if err != nil {
+		return nil, err
+	}
+	forecastResult, err := globals.Forecasters[parameters.Model].Forecast(ctx, input, options)
+	if err != nil {
+		return nil, translateForecastError(err)
+	}
+
+	// now compare the forecast of every held-out year with the recorded
+	// per-person water usage of the year
+	usageByYear := make(map[int]float64)
+	for _, dataPoint := range data.WaterUsages {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, err
+		}
+		usageByYear[year] = dataPoint.Value
+	}
+	var comparisons []forecast.Comparison
+	for _, dataPoint := range forecastResult.Scenarios[recordedScenario] {
+		year, err := dataPoint.Year()
+		if err != nil {
+			return nil, err
+		}
+		usage, usageRecorded := usageByYear[year]
+		population, populationRecorded := populationByYear[year]
+		if year <= cutoff || !usageRecorded || !populationRecorded {
+			continue
+		}
+		comparisons = append(comparisons, forecast.Comparison{Actual: usage / population, Forecast: dataPoint})
+	}
+	return comparisons, nil
+}
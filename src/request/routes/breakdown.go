@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+
+	"microservice/forecast"
+	"microservice/globals"
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+	"microservice/vars"
+)
+
+// municipalityKeyLength is the length of the regional key of a municipality
+const municipalityKeyLength = 12
+
+// groupPrefixLengths maps the administrative levels which may be used to group
+// the municipalities to the length of their regional key. The regional key of
+// a municipality starts with the keys of the areas it belongs to
+var groupPrefixLengths = map[string]int{
+	"state":              2,
+	"governmentDistrict": 3,
+	"district":           5,
+	"association":        9,
+	"municipality":       municipalityKeyLength,
+}
+
+// groupMunicipalities groups the municipalities by the prefix of their key
+// with the supplied length
+func groupMunicipalities(municipalityKeys []string, prefixLength int) map[string][]string {
+	groups := make(map[string][]string)
+	for _, municipalityKey := range municipalityKeys {
+		groupKey := municipalityKey
+		if len(groupKey) > prefixLength {
+			groupKey = groupKey[:prefixLength]
+		}
+		groups[groupKey] = append(groups[groupKey], municipalityKey)
+	}
+	return groups
+}
+
+// forecastAreas forecasts every group of municipalities separately. The
+// forecasts are calculated in parallel while at most as many forecasts as the
+// model backends execute concurrently are started at the same time. If the
+// forecast of a group fails, the error is stored in its prognosis instead of
+// failing all forecasts. Only if the forecast queue is full, the remaining
+// forecasts are cancelled and the error is returned, since a partial
+// breakdown would depend on the load of the service. The name of every group
+// is looked up in the shapes
+func forecastAreas(ctx context.Context, logger zerolog.Logger, parameters forecastParameters,
+	groups map[string][]string, until int) (map[string]structs.AreaPrognosis, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	var waitGroup sync.WaitGroup
+	var queueError error
+	slots := make(chan struct{}, vars.ForecastConcurrency)
+	prognoses := make(map[string]structs.AreaPrognosis)
+
+	for groupKey, municipalityKeys := range groups {
+		waitGroup.Add(1)
+		go func(groupKey string, municipalityKeys []string) {
+			defer waitGroup.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return
+			}
+
+			areaLogger := logger.With().Str("area", groupKey).Logger()
+			prognosis, err := forecastArea(ctx, areaLogger, parameters, municipalityKeys, until)
+			prognosis.MunicipalityKeys = municipalityKeys
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil && queueError == nil {
+				queueError = err
+				cancel()
+			}
+			prognoses[groupKey] = prognosis
+		}(groupKey, municipalityKeys)
+	}
+	waitGroup.Wait()
+	if queueError != nil {
+		return nil, queueError
+	}
+
+	groupKeys := make([]string, 0, len(groups))
+	for groupKey := range groups {
+		groupKeys = append(groupKeys, groupKey)
+	}
+	names, err := getShapeNames(ctx, groupKeys)
+	if err != nil {
+		logger.Warn().Err(err).Msg("unable to get the names of the areas")
+	}
+	for groupKey, prognosis := range prognoses {
+		prognosis.Name = names[groupKey]
+		prognoses[groupKey] = prognosis
+	}
+	return prognoses, nil
+}
+
+// getShapeNames returns the names of the shapes with the supplied keys. The key
+// of the mapping is the key of the shape
+func getShapeNames(ctx context.Context, keys []string) (map[string]string, error) {
+	rows, err := vars.SqlQueries.QueryContext(ctx, globals.Db, "get-shape-names", pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var key, name string
+		if err := rows.Scan(&key, &name); err != nil {
+			return nil, err
+		}
+		names[key] = name
+	}
+	return names, rows.Err()
+}
+
+// forecastArea forecasts the migration levels of the municipalities which are
+// forecast together in the requested measure. Errors are converted into
+// request errors which are stored in the returned prognosis. Only if the
+// forecast queue is full, the error is returned
+func forecastArea(ctx context.Context, logger zerolog.Logger, parameters forecastParameters,
+	municipalityKeys []string, until int) (structs.AreaPrognosis, error) {
+	prognosis, err := func() (structs.AreaPrognosis, error) {
+		var prognosis structs.AreaPrognosis
+		data, err := pullAreaData(ctx, logger, municipalityKeys, parameters)
+		if err != nil {
+			return prognosis, err
+		}
+		prognosis.Outliers = data.Outliers
+		prognosis.DataQuality = data.DataQuality
+		input, options, err := prepareForecast(data, parameters, until)
+		if err != nil {
+			return prognosis, err
+		}
+		result, err := globals.Forecasters[parameters.Model].Forecast(ctx, input, options)
+		if err != nil {
+			return prognosis, err
+		}
+		prognosis.Prognoses = make(map[string][]structs.OutputDataPoint)
+		for _, migrationLevel := range data.MigrationLevels {
+			prognosis.Prognoses[migrationLevel] = result.Scenarios[migrationLevel]
+		}
+		if parameters.Measure != measurePerCapita {
+			prognosis.Totals, err = totalDemands(prognosis.Prognoses, input)
+			if err != nil {
+				return prognosis, translateForecastError(err)
+			}
+		}
+		if parameters.Measure == measureTotal {
+			prognosis.Prognoses = nil
+		}
+		return prognosis, nil
+	}()
+	if errors.Is(err, forecast.ErrQueueFull) {
+		return structs.AreaPrognosis{}, translateForecastError(err)
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msg("unable to forecast area")
+		prognosis.Prognoses, prognosis.Totals = nil, nil
+		prognosis.Error = toRequestError(logger, translateForecastError(err))
+	}
+	return prognosis, nil
+}
+
+// toRequestError returns the request error wrapped by the error. Other errors
+// are converted into an internal error which is embedded into a response
+// instead of being sent as error response
+func toRequestError(logger zerolog.Logger, err error) *structs.RequestError {
+	var requestError *structs.RequestError
+	if errors.As(err, &requestError) {
+		return requestError
+	}
+	requestError, buildError := requestErrors.BuildRequestError(requestErrors.InternalError)
+	if buildError != nil {
+		logger.Error().Err(buildError).Msg("unable to build request error")
+	}
+	return requestError
+}
@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+)
+
+// maximumCustomScenarios is the maximum number of custom population scenarios
+// which may be supplied in a single request
+const maximumCustomScenarios = 10
+
+// scenarioNamePattern matches the names which are allowed for custom population
+// scenarios
+var scenarioNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// customForecastBody is the body of a request for a forecast with custom
+// population scenarios
+type customForecastBody struct {
+	// Keys contains the keys of the areas which shall be forecast. The keys
+	// may also be set as query parameter
+	Keys []string `json:"keys"`
+
+	// Scenarios maps the name of a custom population scenario to the scenario
+	Scenarios map[string]structs.CustomScenario `json:"scenarios"`
+}
+
+/*
+CustomForecastRequest
+
+This handler calculates a new forecast for the areas selected in the request
+body. Next to the migration levels, a forecast is calculated for every custom
+population scenario contained in the request body. The model options are read
+from the query parameters like in the ForecastRequest handler
+*/
+func CustomForecastRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	handleCustomForecastRequest(apiVersion1, responseWriter, request)
+}
+
+// CustomForecastRequestV2 is the CustomForecastRequest handler of the second
+// API version which sends back a forecast for every migration level of the
+// population prognosis
+func CustomForecastRequestV2(responseWriter http.ResponseWriter, request *http.Request) {
+	handleCustomForecastRequest(apiVersion2, responseWriter, request)
+}
+
+// handleCustomForecastRequest reads the parameters and the custom population
+// scenarios of the request and sends back the forecast in the format of the
+// API version
+func handleCustomForecastRequest(version apiVersion, responseWriter http.ResponseWriter, request *http.Request) {
+	var body customForecastBody
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		requestErrors.RespondWithError(buildRequestErrorWithDetails(requestErrors.InvalidRequestBody, err.Error()),
+			responseWriter)
+		return
+	}
+	if len(body.Keys) > 0 {
+		request = request.WithContext(context.WithValue(request.Context(), "key", body.Keys))
+	}
+
+	parameters, err := parseForecastParameters(request)
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+	if err := validateCustomScenarios(body.Scenarios); err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+	parameters.CustomScenarios = body.Scenarios
+
+	respondWithForecast(version, *parameters, responseWriter, request)
+}
+
+// validateCustomScenarios checks the custom scenarios for errors which do not
+// depend on the data pulled from the database
+func validateCustomScenarios(scenarios map[string]structs.CustomScenario) error {
+	if len(scenarios) == 0 {
+		return invalidParameter("scenarios", "expected at least one custom population scenario")
+	}
+	if len(scenarios) > maximumCustomScenarios {
+		return invalidParameter("scenarios", fmt.Sprintf("at most %d scenarios may be supplied",
+			maximumCustomScenarios))
+	}
+	for name, scenario := range scenarios {
+		if !scenarioNamePattern.MatchString(name) {
+			return invalidParameter("scenarios", fmt.Sprintf(
+				"%s: the name may only contain letters, digits, dashes and underscores", name))
+		}
+		if len(scenario.Population) == 0 {
+			return invalidParameter("scenarios", fmt.Sprintf("%s: the scenario contains no population", name))
+		}
+		years := make(map[int]bool)
+		for _, value := range scenario.Population {
+			if years[value.Year] {
+				return invalidParameter("scenarios", fmt.Sprintf("%s: the year %d is set twice", name, value.Year))
+			}
+			years[value.Year] = true
+			if scenario.Base == "" && value.Population <= 0 {
+				return invalidParameter("scenarios", fmt.Sprintf("%s: expected a positive population", name))
+			}
+		}
+	}
+	return nil
+}
+
+// buildCustomScenario converts a custom scenario into a population series with
+// the same years as the population prognosis. If the scenario is based on a
+// migration level, the additional inhabitants are added to the prognosis of
+// the migration level. Additional inhabitants are carried forward to the years
+// which are not listed in the scenario. Otherwise, the scenario needs to
+// contain the population of every year of the prognosis
+func buildCustomScenario(name string, scenario structs.CustomScenario,
+	populationScenarios map[string][]structs.InputDataPoint) ([]structs.InputDataPoint, error) {
+	if _, nameUsed := populationScenarios[name]; nameUsed {
+		return nil, invalidParameter("scenarios", fmt.Sprintf("%s: the name is used by a migration level", name))
+	}
+
+	// without a base, the years of the first migration level are used. the
+	// years of all migration levels are the same after truncating them
+	migrationLevels := make([]string, 0, len(populationScenarios))
+	for migrationLevel := range populationScenarios {
+		migrationLevels = append(migrationLevels, migrationLevel)
+	}
+	sort.Strings(migrationLevels)
+	reference := populationScenarios[migrationLevels[0]]
+	if scenario.Base != "" {
+		var baseExists bool
+		reference, baseExists = populationScenarios[scenario.Base]
+		if !baseExists {
+			return nil, invalidParameter("scenarios", fmt.Sprintf("%s: unknown migration level '%s'", name,
+				scenario.Base))
+		}
+	}
+
+	values := append([]structs.PopulationValue{}, scenario.Population...)
+	sort.Slice(values, func(i, j int) bool { return values[i].Year < values[j].Year })
+
+	var series []structs.InputDataPoint
+	for _, referenceDataPoint := range reference {
+		year, err := referenceDataPoint.Year()
+		if err != nil {
+			return nil, err
+		}
+
+		population, populationSet := 0.0, false
+		for _, value := range values {
+			if value.Year > year {
+				break
+			}
+			if scenario.Base != "" || value.Year == year {
+				population, populationSet = value.Population, true
+			}
+		}
+		if scenario.Base != "" {
+			population += referenceDataPoint.Value
+		} else if !populationSet {
+			return nil, invalidParameter("scenarios", fmt.Sprintf("%s: no population set for %d", name, year))
+		}
+		if population <= 0 {
+			return nil, invalidParameter("scenarios", fmt.Sprintf("%s: the population of %d is not positive",
+				name, year))
+		}
+		series = append(series, structs.InputDataPoint{Date: referenceDataPoint.Date, Value: population})
+	}
+	return series, nil
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"microservice/structs"
+)
+
+// populationValues builds the population values of a custom scenario from
+// pairs of years and populations
+func populationValues(pairs ...float64) []structs.PopulationValue {
+	var values []structs.PopulationValue
+	for index := 0; index < len(pairs); index += 2 {
+		values = append(values, structs.PopulationValue{Year: int(pairs[index]), Population: pairs[index+1]})
+	}
+	return values
+}
+
+func TestBuildCustomScenario(t *testing.T) {
+	// the prognosis of both migration levels runs from 2026 until 2032
+	populationScenarios := map[string][]structs.InputDataPoint{
+		"low":    series(2026, 9000, 9000, 9000, 9000, 9000, 9000, 9000),
+		"medium": series(2026, 10000, 10000, 10000, 10000, 10000, 10000, 10000),
+	}
+
+	tests := []struct {
+		name     string
+		scenario structs.CustomScenario
+		// want contains the population from 2026 until 2032. If empty, the
+		// scenario is expected to be rejected with the message
+		want    []float64
+		message string
+	}{
+		{
+			name: "new residential area adding 3000 inhabitants by 2030",
+			scenario: structs.CustomScenario{
+				Base:       "medium",
+				Population: populationValues(2030, 3000, 2028, 1000),
+			},
+			want: []float64{10000, 10000, 11000, 11000, 13000, 13000, 13000},
+		},
+		{
+			name:     "additional inhabitants before the prognosis",
+			scenario: structs.CustomScenario{Base: "low", Population: populationValues(2020, 500)},
+			want:     []float64{9500, 9500, 9500, 9500, 9500, 9500, 9500},
+		},
+		{
+			name:     "removed inhabitants leaving no population",
+			scenario: structs.CustomScenario{Base: "low", Population: populationValues(2029, -9000)},
+			message:  "the population of 2029 is not positive",
+		},
+		{
+			name:     "unknown base",
+			scenario: structs.CustomScenario{Base: "extreme", Population: populationValues(2030, 3000)},
+			message:  "unknown migration level 'extreme'",
+		},
+		{
+			name: "every year without a base",
+			scenario: structs.CustomScenario{
+				Population: populationValues(2026, 1, 2027, 2, 2028, 3, 2029, 4, 2030, 5, 2031, 6, 2032, 7),
+			},
+			want: []float64{1, 2, 3, 4, 5, 6, 7},
+		},
+		{
+			name: "missing year without a base",
+			scenario: structs.CustomScenario{
+				Population: populationValues(2026, 1, 2027, 2, 2028, 3, 2030, 5, 2031, 6, 2032, 7),
+			},
+			message: "no population set for 2029",
+		},
+		{
+			name: "zero population without a base",
+			scenario: structs.CustomScenario{
+				Population: populationValues(2026, 1, 2027, 2, 2028, 0, 2029, 4, 2030, 5, 2031, 6, 2032, 7),
+			},
+			message: "the population of 2028 is not positive",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			population, err := buildCustomScenario("plan", test.scenario, populationScenarios)
+			if test.message != "" {
+				if err == nil || !strings.Contains(err.Error(), test.message) {
+					t.Fatalf("got error %v, want %q", err, test.message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(years(t, population)) != fmt.Sprint([]int{2026, 2027, 2028, 2029, 2030, 2031, 2032}) {
+				t.Errorf("got years %v, want the years of the prognosis", years(t, population))
+			}
+			var values []float64
+			for _, dataPoint := range population {
+				values = append(values, dataPoint.Value)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(test.want) {
+				t.Errorf("got population %v, want %v", values, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildCustomScenarioRejectsMigrationLevelNames(t *testing.T) {
+	populationScenarios := map[string][]structs.InputDataPoint{"medium": series(2026, 10000)}
+	scenario := structs.CustomScenario{Population: populationValues(2026, 12000)}
+	_, err := buildCustomScenario("medium", scenario, populationScenarios)
+	if err == nil || !strings.Contains(err.Error(), "the name is used by a migration level") {
+		t.Errorf("got error %v, want the name to be rejected", err)
+	}
+}
@@ -0,0 +1,652 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"microservice/cache"
+	"microservice/forecast"
+	"microservice/globals"
+	"microservice/history"
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+	"microservice/utils"
+	"microservice/vars"
+)
+
+// maximumIntervalWidths is the maximum number of prediction intervals which may
+// be requested for a single forecast
+const maximumIntervalWidths = 5
+
+// maximumAreaForecasts is the maximum number of areas which may be forecast
+// separately for a breakdown or a grouping of a single request
+const maximumAreaForecasts = 100
+
+// includeComponents and includeFitted are the additional outputs of the model
+// which may be requested with the include parameter
+const (
+	includeComponents = "components"
+	includeFitted     = "fitted"
+)
+
+// forecastParameters contains the parameters of a forecast which have been
+// read from an incoming request. Since the parameters do not reference the
+// request, a forecast may be calculated after the request has been answered
+type forecastParameters struct {
+	// RequestID is the identifier of the request which triggered the forecast
+	RequestID string
+
+	// ShapeKeys contains the keys of the areas which shall be forecast
+	ShapeKeys []string
+
+	// Model contains the name of the model backend used for the forecast
+	Model string
+
+	// Horizon contains the number of years which shall be forecast after the
+	// last year with water usage data. If zero, the horizon is not restricted
+	Horizon int
+
+	// Until contains the last year which shall be forecast. If zero, the last
+	// year is not restricted
+	Until int
+
+	// IntervalWidths contains the widths of the prediction intervals which
+	// shall be calculated
+	IntervalWidths []float64
+
+	// ModelOptions contains the validated options of the model
+	ModelOptions structs.ModelOptions
+
+	// CustomScenarios contains the population scenarios supplied by the
+	// client which are forecast next to the migration levels
+	CustomScenarios map[string]structs.CustomScenario
+
+	// Breakdown indicates that every municipality of the selected areas shall
+	// be forecast separately next to the aggregated forecast
+	Breakdown bool
+
+	// GroupBy contains the administrative level by which the municipalities
+	// are grouped. Every group is forecast separately next to the aggregated
+	// forecast. If empty, the municipalities are not grouped
+	GroupBy string
+
+	// Include contains the additional outputs of the model which shall be
+	// sent back next to the forecast
+	Include []string
+
+	// Measure contains the measure of the forecast. The per-person water
+	// usage, the total water demand or both are sent back
+	Measure string
+
+	// UsageTypes contains the usage types of the water usages the model is
+	// fitted on. If empty, the water usages of all usage types are used
+	UsageTypes []string
+
+	// From contains the first year of the water usages the model is fitted
+	// on. If zero, the first recorded year is used
+	From int
+
+	// To contains the last year of the water usages the model is fitted on.
+	// If zero, the last recorded year is used
+	To int
+
+	// AsOf contains the year the forecast is calculated as of. The water
+	// usages and the population recorded after the year are ignored. If zero,
+	// all recorded data is used
+	AsOf int
+
+	// Outliers configures the detection of outliers in the water usages. If
+	// nil, the water usages are not checked for outliers
+	Outliers *structs.OutlierOptions
+
+	// GapPolicy contains the policy which is applied to the years without a
+	// water usage or without a positive population
+	GapPolicy string
+}
+
+// lastTrainingYear returns the last year of the water usages the model may be
+// fitted on. If zero, the water usages are not restricted
+func (p forecastParameters) lastTrainingYear() int {
+	if p.To != 0 {
+		return p.To
+	}
+	return p.AsOf
+}
+
+// parseForecastParameters reads the parameters of a forecast from the context of
+// the request. If the parameters are invalid, a request error is returned
+func parseForecastParameters(request *http.Request) (*forecastParameters, error) {
+	parameters := &forecastParameters{
+		RequestID: middleware.GetReqID(request.Context()),
+		Model:     globals.DefaultForecaster,
+	}
+
+	// get the shape keys that are set in the query url and check if any keys
+	// have been set
+	ctxShapeKeys := request.Context().Value("key")
+	if ctxShapeKeys == nil {
+		return nil, buildRequestError(requestErrors.MissingShapeKeys)
+	}
+	parameters.ShapeKeys = ctxShapeKeys.([]string)
+
+	// now select the model backend. if the request did not select a model, the
+	// configured default is used
+	if ctxModel := request.Context().Value("model"); ctxModel != nil {
+		parameters.Model = ctxModel.([]string)[0]
+	}
+	if _, modelAvailable := globals.Forecasters[parameters.Model]; !modelAvailable {
+		return nil, buildRequestError(requestErrors.UnknownModel)
+	}
+
+	// now read the forecast horizon which may either be set as number of years
+	// or as last year of the forecast
+	var err error
+	parameters.Horizon, err = intParameter(request, "horizon", 0)
+	if err != nil {
+		return nil, err
+	}
+	parameters.Until, err = intParameter(request, "until", 0)
+	if err != nil {
+		return nil, err
+	}
+	if parameters.Horizon < 0 {
+		return nil, invalidParameter("horizon", "expected a positive number of years")
+	}
+	if parameters.Horizon != 0 && parameters.Until != 0 {
+		return nil, invalidParameter("until", "the parameter may not be combined with horizon")
+	}
+
+	// now read the widths of the prediction intervals
+	for _, rawWidth := range queryParameters(request, "interval") {
+		width, err := strconv.ParseFloat(rawWidth, 64)
+		if err != nil || width <= 0 || width >= 1 {
+			return nil, invalidParameter("interval", "expected a number between 0 and 1")
+		}
+		if !utils.ArrayContains(parameters.IntervalWidths, width) {
+			parameters.IntervalWidths = append(parameters.IntervalWidths, width)
+		}
+	}
+	if len(parameters.IntervalWidths) > maximumIntervalWidths {
+		return nil, invalidParameter("interval", fmt.Sprintf("at most %d widths may be requested",
+			maximumIntervalWidths))
+	}
+	if len(parameters.IntervalWidths) == 0 {
+		parameters.IntervalWidths = []float64{forecast.DefaultIntervalWidth}
+	}
+
+	parameters.Breakdown, err = boolParameter(request, "breakdown", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if groupBy, isSet := queryParameter(request, "groupBy"); isSet {
+		if _, levelExists := groupPrefixLengths[groupBy]; !levelExists {
+			return nil, invalidParameter("groupBy", "unknown administrative level")
+		}
+		parameters.GroupBy = groupBy
+	}
+
+	// now read the additional outputs of the model. the outputs may be set as
+	// comma-separated list or by repeating the parameter
+	for _, rawInclude := range queryParameters(request, "include") {
+		for _, include := range strings.Split(rawInclude, ",") {
+			include = strings.TrimSpace(include)
+			if include != includeComponents && include != includeFitted {
+				return nil, invalidParameter("include", fmt.Sprintf("expected '%s' or '%s'",
+					includeComponents, includeFitted))
+			}
+			if !utils.ArrayContains(parameters.Include, include) {
+				parameters.Include = append(parameters.Include, include)
+			}
+		}
+	}
+	sort.Strings(parameters.Include)
+
+	// now read the usage types which restrict the water usages. the usage
+	// types may be set as comma-separated list or by repeating the parameter
+	for _, rawUsageType := range queryParameters(request, "usageType") {
+		for _, usageType := range strings.Split(rawUsageType, ",") {
+			usageType = strings.TrimSpace(usageType)
+			if usageType == "" {
+				return nil, invalidParameter("usageType", "expected a usage type")
+			}
+			if !utils.ArrayContains(parameters.UsageTypes, usageType) {
+				parameters.UsageTypes = append(parameters.UsageTypes, usageType)
+			}
+		}
+	}
+	sort.Strings(parameters.UsageTypes)
+
+	// now read the training window. the window may not end after the year the
+	// forecast is calculated as of
+	for _, year := range []struct {
+		name   string
+		target *int
+	}{{"from", &parameters.From}, {"to", &parameters.To}, {"asOf", &parameters.AsOf}} {
+		*year.target, err = intParameter(request, year.name, 0)
+		if err != nil {
+			return nil, err
+		}
+		if *year.target < 0 {
+			return nil, invalidParameter(year.name, "expected a year")
+		}
+	}
+	if parameters.From != 0 && parameters.To != 0 && parameters.From > parameters.To {
+		return nil, invalidParameter("from", "the window needs to start before it ends")
+	}
+	if parameters.AsOf != 0 && parameters.To > parameters.AsOf {
+		return nil, invalidParameter("to", "the window may not end after the as-of year")
+	}
+	if parameters.AsOf != 0 && parameters.From > parameters.AsOf {
+		return nil, invalidParameter("from", "the window may not start after the as-of year")
+	}
+
+	parameters.Outliers, err = parseOutlierOptions(request)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters.GapPolicy = forecast.GapInterpolate
+	if gapPolicy, isSet := queryParameter(request, "gaps"); isSet {
+		if gapPolicy != forecast.GapInterpolate && gapPolicy != forecast.GapReject && gapPolicy != forecast.GapDrop {
+			return nil, invalidParameter("gaps", fmt.Sprintf("expected '%s', '%s' or '%s'",
+				forecast.GapInterpolate, forecast.GapReject, forecast.GapDrop))
+		}
+		parameters.GapPolicy = gapPolicy
+	}
+
+	parameters.Measure = measurePerCapita
+	if measure, isSet := queryParameter(request, "measure"); isSet {
+		if measure != measurePerCapita && measure != measureTotal && measure != measureBoth {
+			return nil, invalidParameter("measure", fmt.Sprintf("expected '%s', '%s' or '%s'",
+				measurePerCapita, measureTotal, measureBoth))
+		}
+		parameters.Measure = measure
+	}
+
+	parameters.ModelOptions, err = parseModelOptions(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return parameters, nil
+}
+
+// parseOutlierOptions reads the configuration of the outlier detection from the
+// context of the request. The detection is enabled by selecting the action
+// applied to the outliers. If the detection is not requested, nil is returned
+func parseOutlierOptions(request *http.Request) (*structs.OutlierOptions, error) {
+	action, actionSet := queryParameter(request, "outliers")
+	method, methodSet := queryParameter(request, "outlierMethod")
+	threshold, err := floatParameter(request, "outlierThreshold")
+	if err != nil {
+		return nil, err
+	}
+	if !actionSet {
+		if methodSet {
+			return nil, invalidParameter("outlierMethod", "the parameter requires the outliers parameter")
+		}
+		if threshold != nil {
+			return nil, invalidParameter("outlierThreshold", "the parameter requires the outliers parameter")
+		}
+		return nil, nil
+	}
+
+	if action != forecast.OutlierKeep && action != forecast.OutlierDrop && action != forecast.OutlierWinsorize {
+		return nil, invalidParameter("outliers", fmt.Sprintf("expected '%s', '%s' or '%s'",
+			forecast.OutlierKeep, forecast.OutlierDrop, forecast.OutlierWinsorize))
+	}
+	if !methodSet {
+		method = forecast.OutlierMAD
+	}
+	options := &structs.OutlierOptions{Method: method, Action: action}
+	defaultThreshold, methodExists := forecast.DefaultOutlierThresholds[method]
+	if !methodExists {
+		return nil, invalidParameter("outlierMethod", fmt.Sprintf("expected '%s' or '%s'", forecast.OutlierMAD,
+			forecast.OutlierIQR))
+	}
+	options.Threshold = defaultThreshold
+	if threshold != nil {
+		if *threshold <= 0 {
+			return nil, invalidParameter("outlierThreshold", "expected a positive number")
+		}
+		options.Threshold = *threshold
+	}
+	return options, nil
+}
+
+// parseModelOptions reads the model options from the context of the request.
+// The options of the selected preset are used for every option which is not set
+// in the request. If the options are invalid, a request error is returned
+func parseModelOptions(request *http.Request) (structs.ModelOptions, error) {
+	presetName, isSet := queryParameter(request, "preset")
+	if !isSet {
+		presetName = forecast.DefaultPreset
+	}
+	options, presetExists := forecast.Presets[presetName]
+	if !presetExists {
+		return options, invalidParameter("preset", "unknown preset")
+	}
+
+	var err error
+	if growth, isSet := queryParameter(request, "growth"); isSet {
+		options.Growth = growth
+	}
+	if populationMode, isSet := queryParameter(request, "populationMode"); isSet {
+		options.PopulationMode = populationMode
+	}
+	if options.Cap, err = floatParameter(request, "cap"); err != nil {
+		return options, err
+	}
+	if options.Floor, err = floatParameter(request, "floor"); err != nil {
+		return options, err
+	}
+	if options.YearlySeasonality, err = boolParameter(request, "yearlySeasonality",
+		options.YearlySeasonality); err != nil {
+		return options, err
+	}
+	if options.WeeklySeasonality, err = boolParameter(request, "weeklySeasonality",
+		options.WeeklySeasonality); err != nil {
+		return options, err
+	}
+	if options.DailySeasonality, err = boolParameter(request, "dailySeasonality",
+		options.DailySeasonality); err != nil {
+		return options, err
+	}
+	changepointPriorScale, err := floatParameter(request, "changepointPriorScale")
+	if err != nil {
+		return options, err
+	}
+	if changepointPriorScale != nil {
+		options.ChangepointPriorScale = *changepointPriorScale
+	}
+	rawChangepoints := queryParameters(request, "changepoint")
+	if len(rawChangepoints) > 0 {
+		options.Changepoints = nil
+	}
+	for _, rawChangepoint := range rawChangepoints {
+		changepoint, err := strconv.Atoi(rawChangepoint)
+		if err != nil {
+			return options, invalidParameter("changepoint", "expected a year")
+		}
+		options.Changepoints = append(options.Changepoints, changepoint)
+	}
+	sort.Ints(options.Changepoints)
+
+	var optionError *forecast.OptionError
+	if err := forecast.ValidateModelOptions(options); errors.As(err, &optionError) {
+		return options, invalidParameter(optionError.Option, optionError.Reason)
+	} else if err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// buildRequestError builds the request error for the supplied error code and
+// returns it as error. If the request error could not be built, the error
+// raised while building it is returned instead
+func buildRequestError(code string) error {
+	requestError, err := requestErrors.BuildRequestError(code)
+	if err != nil {
+		return err
+	}
+	return requestError
+}
+
+// translateForecastError converts the errors returned by the model backends
+// into the matching request errors. Unknown errors are returned unchanged
+func translateForecastError(err error) error {
+	switch {
+	case errors.Is(err, forecast.ErrQueueFull):
+		return buildRequestError(requestErrors.ForecastQueueFull)
+	case errors.Is(err, forecast.ErrTooFewDataPoints):
+		return buildRequestError(requestErrors.TooFewDataPoints)
+	case errors.Is(err, forecast.ErrSeriesLengthMismatch):
+		return buildRequestError(requestErrors.SeriesLengthMismatch)
+	case errors.Is(err, forecast.ErrMissingDependency):
+		return buildRequestError(requestErrors.ModelDependencyMissing)
+	case errors.Is(err, forecast.ErrUnsupportedOption):
+		return buildRequestErrorWithDetails(requestErrors.UnsupportedModelOption, err.Error())
+	case errors.Is(err, forecast.ErrModelFailed):
+		return buildRequestErrorWithDetails(requestErrors.ModelExecutionFailed, err.Error())
+	case errors.Is(err, forecast.ErrDataGaps):
+		return buildRequestErrorWithDetails(requestErrors.DataGaps, err.Error())
+	default:
+		return err
+	}
+}
+
+// forecastOutcome contains a calculated forecast and information about how the
+// forecast has been calculated
+type forecastOutcome struct {
+	// Response contains the forecast which is sent back to the client
+	Response *structs.ScenarioResponse
+
+	// CacheHit indicates that the forecast has been read from the cache
+	CacheHit bool
+
+	// RunID is the id under which the forecast has been stored in the history.
+	// The id is empty if the forecast has not been stored
+	RunID string
+}
+
+// calculateForecast pulls the data needed for the forecast from the database
+// and calculates the forecast with the selected model backend. If the same
+// forecast has been calculated before, the cached forecast is returned. The
+// database queries and the model backend are cancelled if the context is
+// cancelled or the configured forecast timeout is exceeded
+func calculateForecast(ctx context.Context, parameters forecastParameters) (outcome *forecastOutcome, err error) {
+	logger := vars.HttpLogger.With().Str("requestID", parameters.RequestID).Logger()
+	startTime := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, vars.ForecastTimeout)
+	defer cancel()
+	defer func() {
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logger.Warn().Err(err).Str("timeout", vars.ForecastTimeout.String()).Msg("forecast timed out")
+			outcome, err = nil, buildRequestError(requestErrors.ForecastTimeout)
+		}
+	}()
+
+	municipalityKeys, err := resolveMunicipalityKeys(ctx, logger, parameters.ShapeKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if parameters.Breakdown && len(municipalityKeys) > maximumAreaForecasts {
+		return nil, invalidParameter("breakdown", fmt.Sprintf(
+			"the selected areas contain more than %d municipalities", maximumAreaForecasts))
+	}
+	var groups map[string][]string
+	if parameters.GroupBy != "" {
+		groups = groupMunicipalities(municipalityKeys, groupPrefixLengths[parameters.GroupBy])
+		if len(groups) > maximumAreaForecasts {
+			return nil, invalidParameter("groupBy", fmt.Sprintf(
+				"the selected areas contain more than %d groups", maximumAreaForecasts))
+		}
+	}
+
+	if err := validateUsageTypes(ctx, municipalityKeys, parameters.UsageTypes); err != nil {
+		return nil, err
+	}
+	data, err := pullAreaData(ctx, logger, municipalityKeys, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	trainingWindow, err := data.trainingWindow(parameters.AsOf)
+	if err != nil {
+		return nil, err
+	}
+
+	// now determine the last year of the forecast. if the request did not
+	// restrict the forecast, it ends with the population prognosis
+	until := data.LastPrognosisYear
+	switch {
+	case parameters.Until != 0:
+		until = parameters.Until
+	case parameters.Horizon != 0:
+		until = data.FirstForecastYear - 1 + parameters.Horizon
+	}
+	forecastInput, forecastOptions, err := prepareForecast(data, parameters, until)
+	if err != nil {
+		return nil, err
+	}
+	// the additional outputs are only calculated for the aggregated forecast
+	forecastOptions.IncludeComponents = utils.ArrayContains(parameters.Include, includeComponents)
+	forecastOptions.IncludeFitted = utils.ArrayContains(parameters.Include, includeFitted)
+
+	// now add the custom population scenarios supplied by the client. the
+	// custom scenarios are built after truncating the migration levels to
+	// match the years of the forecast
+	customScenarios := make(map[string][]structs.InputDataPoint)
+	for name, customScenario := range parameters.CustomScenarios {
+		customScenarios[name], err = buildCustomScenario(name, customScenario, forecastInput.PopulationScenarios)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, populationData := range customScenarios {
+		forecastInput.PopulationScenarios[name] = populationData
+	}
+
+	// now check if the same forecast has already been calculated. the cache
+	// key contains everything the forecast is calculated from
+	var cacheKey string
+	if globals.Cache != nil {
+		sortedMunicipalityKeys := append([]string{}, municipalityKeys...)
+		sort.Strings(sortedMunicipalityKeys)
+		cacheKey, err = cache.Key(struct {
+			MunicipalityKeys []string
+			Model            string
+			Input            forecast.Input
+			Options          forecast.Options
+			Breakdown        bool
+			GroupBy          string
+			Measure          string
+			UsageTypes       []string
+			TrainingWindow   *structs.TrainingWindow
+			Outliers         *structs.OutlierOptions
+			GapPolicy        string
+		}{sortedMunicipalityKeys, parameters.Model, forecastInput, forecastOptions, parameters.Breakdown,
+			parameters.GroupBy, parameters.Measure, parameters.UsageTypes, trainingWindow, parameters.Outliers,
+			parameters.GapPolicy})
+		if err != nil {
+			return nil, err
+		}
+		cachedResponse, cacheHit, err := globals.Cache.Get(ctx, cacheKey)
+		if err != nil {
+			logger.Warn().Err(err).Msg("unable to read forecast from cache")
+		}
+		if cacheHit {
+			logger.Info().Msg("using cached forecast")
+			outcome = &forecastOutcome{Response: cachedResponse, CacheHit: true}
+		}
+	}
+
+	if outcome == nil {
+		forecastResult, err := globals.Forecasters[parameters.Model].Forecast(ctx, forecastInput, forecastOptions)
+		if err != nil {
+			return nil, translateForecastError(err)
+		}
+
+		// now build the response
+		outcome = &forecastOutcome{Response: &structs.ScenarioResponse{
+			Prognoses: make(map[string][]structs.OutputDataPoint),
+			Metadata: &structs.Metadata{
+				Model:          parameters.Model,
+				Horizon:        forecastOptions.Horizon,
+				Until:          until,
+				IntervalWidths: forecastOptions.IntervalWidths,
+				ModelOptions:   &forecastOptions.Model,
+				Include:        parameters.Include,
+				Measure:        parameters.Measure,
+				UsageTypes:     parameters.UsageTypes,
+				TrainingWindow: trainingWindow,
+				Outliers:       data.Outliers,
+				DataQuality:    data.DataQuality,
+			},
+			Components: forecastResult.Components,
+			Fitted:     forecastResult.Fitted,
+		}}
+		for _, migrationLevel := range data.MigrationLevels {
+			outcome.Response.Prognoses[migrationLevel] = forecastResult.Scenarios[migrationLevel]
+		}
+		if len(customScenarios) > 0 {
+			outcome.Response.CustomPrognoses = make(map[string][]structs.OutputDataPoint)
+			for name := range customScenarios {
+				outcome.Response.CustomPrognoses[name] = forecastResult.Scenarios[name]
+			}
+		}
+
+		// now derive the total water demand from the per-person water usage
+		// if it has been requested. the per-person water usage is only kept
+		// if both measures have been requested
+		if parameters.Measure != measurePerCapita {
+			outcome.Response.Totals, err = totalDemands(forecastResult.Scenarios, forecastInput)
+			if err != nil {
+				return nil, translateForecastError(err)
+			}
+		}
+		if parameters.Measure == measureTotal {
+			outcome.Response.Prognoses = make(map[string][]structs.OutputDataPoint)
+			outcome.Response.CustomPrognoses = nil
+		}
+
+		// now forecast every municipality and every group separately if a
+		// breakdown or a grouping has been requested. the separate forecasts
+		// end with the same year as the aggregated forecast
+		if parameters.Breakdown {
+			outcome.Response.Breakdown, err = forecastAreas(ctx, logger, parameters,
+				groupMunicipalities(municipalityKeys, municipalityKeyLength), until)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if groups != nil {
+			outcome.Response.Groups, err = forecastAreas(ctx, logger, parameters, groups, until)
+			if err != nil {
+				return nil, err
+			}
+			outcome.Response.Metadata.GroupBy = parameters.GroupBy
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if globals.Cache != nil {
+			err = globals.Cache.Set(ctx, cacheKey, outcome.Response)
+			if err != nil {
+				logger.Warn().Err(err).Msg("unable to write forecast into cache")
+			}
+		}
+	}
+
+	// now store the run to allow reproducing the forecast later on
+	if globals.History != nil {
+		outcome.RunID, err = globals.History.Save(ctx, history.Run{
+			Summary: history.Summary{
+				RequestedKeys:    parameters.ShapeKeys,
+				MunicipalityKeys: municipalityKeys,
+				Model:            parameters.Model,
+				Runtime:          time.Since(startTime).Seconds(),
+				CacheHit:         outcome.CacheHit,
+			},
+			Options: forecastOptions,
+			Input:   forecastInput,
+			Result:  outcome.Response,
+		})
+		if err != nil {
+			logger.Warn().Err(err).Msg("unable to store forecast run")
+		}
+	}
+	return outcome, nil
+}
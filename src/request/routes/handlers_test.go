@@ -0,0 +1,347 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qustavo/dotsql"
+
+	"microservice/forecast"
+	"microservice/globals"
+	"microservice/request/middleware"
+	"microservice/structs"
+	"microservice/vars"
+)
+
+// testQueries contains the queries used by the forecast handlers. The text of
+// every query is its name which allows the test database to identify them
+const testQueries = `
+-- name: get-full-municipality-keys
+get-full-municipality-keys
+
+-- name: get-water-usages
+get-water-usages
+
+-- name: get-current-population
+get-current-population
+
+-- name: get-migration-levels
+get-migration-levels
+
+-- name: get-future-population
+get-future-population
+
+-- name: get-shape-names
+get-shape-names
+
+-- name: get-usage-types
+get-usage-types
+
+-- name: get-water-usages-by-type
+get-water-usages-by-type
+`
+
+// testDatabase answers the queries of the handlers with the rows returned by
+// the function. The function receives the text of the query and its arguments
+type testDatabase func(query string, args []driver.Value) [][]driver.Value
+
+func (d testDatabase) Connect(context.Context) (driver.Conn, error) { return testConnection{d}, nil }
+func (d testDatabase) Driver() driver.Driver                        { return nil }
+
+type testConnection struct{ database testDatabase }
+
+func (c testConnection) Prepare(query string) (driver.Stmt, error) {
+	return testStatement{c.database, query}, nil
+}
+func (c testConnection) Close() error { return nil }
+func (c testConnection) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type testStatement struct {
+	database testDatabase
+	query    string
+}
+
+func (s testStatement) Close() error  { return nil }
+func (s testStatement) NumInput() int { return -1 }
+func (s testStatement) Exec([]driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("statements are not supported")
+}
+func (s testStatement) Query(args []driver.Value) (driver.Rows, error) {
+	return &testRows{rows: s.database(s.query, args)}, nil
+}
+
+type testRows struct{ rows [][]driver.Value }
+
+func (r *testRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"value"}
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *testRows) Close() error { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// annualRows returns a row containing the year and the value for every year
+// between the first and the last year
+func annualRows(firstYear, lastYear int, value func(year int) float64) [][]driver.Value {
+	var rows [][]driver.Value
+	for year := firstYear; year <= lastYear; year++ {
+		rows = append(rows, []driver.Value{int64(year), value(year)})
+	}
+	return rows
+}
+
+// setUpForecastHandlers points the handlers to a test database containing the
+// water usages of a single municipality from 2011 until 2020 which have been
+// recorded for the households and the industry. The population has been
+// recorded until 2022 and the prognosis of the low and the high migration
+// level runs from 2021 until 2030. The forecasts are calculated by the stub
+// backend
+func setUpForecastHandlers(t *testing.T) {
+	t.Helper()
+	queries, err := dotsql.LoadFromString(testQueries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database := testDatabase(func(query string, args []driver.Value) [][]driver.Value {
+		switch query {
+		case "get-full-municipality-keys":
+			return [][]driver.Value{{"031510001001"}}
+		case "get-water-usages", "get-water-usages-by-type":
+			return annualRows(2011, 2020, func(year int) float64 { return 1000000 + float64(year-2011)*1000 })
+		case "get-usage-types":
+			// only the municipality of the test database has recorded usage
+			// types
+			if !strings.Contains(fmt.Sprint(args[0]), "031510001001") {
+				return nil
+			}
+			return [][]driver.Value{{"households"}, {"industry"}}
+		case "get-current-population":
+			return annualRows(2011, 2022, func(int) float64 { return 10000 })
+		case "get-migration-levels":
+			return [][]driver.Value{{"low"}, {"high"}}
+		case "get-future-population":
+			growth := 50.0
+			if args[1] == "low" {
+				growth = -50
+			}
+			return annualRows(2021, 2030, func(year int) float64 { return 10000 + float64(year-2020)*growth })
+		case "get-shape-names":
+			return [][]driver.Value{{"031510001001", "Gifhorn"}}
+		}
+		t.Errorf("unexpected query %q", query)
+		return nil
+	})
+
+	previousDb, previousQueries, previousTimeout := globals.Db, vars.SqlQueries, vars.ForecastTimeout
+	previousDefault := globals.DefaultForecaster
+	globals.Db = sql.OpenDB(database)
+	vars.SqlQueries = queries
+	vars.ForecastTimeout = time.Minute
+	globals.Forecasters["stub"] = forecast.StubForecaster{}
+	globals.DefaultForecaster = "stub"
+	t.Cleanup(func() {
+		_ = globals.Db.Close()
+		globals.Db, vars.SqlQueries, vars.ForecastTimeout = previousDb, previousQueries, previousTimeout
+		globals.DefaultForecaster = previousDefault
+		delete(globals.Forecasters, "stub")
+	})
+}
+
+// serveForecast sends the query to the handler and returns the response
+func serveForecast(handler http.HandlerFunc, query string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	recorder := httptest.NewRecorder()
+	middleware.ParseQueryParametersToContext(handler).ServeHTTP(recorder, request)
+	return recorder
+}
+
+// checkPrognosis checks that the prognosis covers every year from 2011 until
+// the last year
+func checkPrognosis(t *testing.T, name string, prognosis []structs.OutputDataPoint, lastYear int) {
+	t.Helper()
+	if len(prognosis) != lastYear-2011+1 {
+		t.Fatalf("%s prognosis contains %d data points, want %d", name, len(prognosis), lastYear-2011+1)
+	}
+	year, err := prognosis[len(prognosis)-1].Year()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if year != lastYear {
+		t.Errorf("%s prognosis ends with %d, want %d", name, year, lastYear)
+	}
+}
+
+func TestForecastRequest(t *testing.T) {
+	setUpForecastHandlers(t)
+
+	recorder := serveForecast(ForecastRequest, "key=03151&until=2025")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response structs.Response
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	checkPrognosis(t, "low", response.LowMigrationData, 2025)
+	checkPrognosis(t, "high", response.HighMigrationData, 2025)
+	if response.MediumMigrationData != nil {
+		t.Errorf("medium prognosis has been sent although the migration level is unknown")
+	}
+	if response.Metadata.Model != "stub" || response.Metadata.Until != 2025 || response.Metadata.Horizon != 5 {
+		t.Errorf("unexpected metadata %+v", response.Metadata)
+	}
+}
+
+func TestForecastRequestV2(t *testing.T) {
+	setUpForecastHandlers(t)
+
+	recorder := serveForecast(ForecastRequestV2, "key=03151&interval=0.8&interval=0.95")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response structs.ScenarioResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Prognoses) != 2 {
+		t.Fatalf("got prognoses for %d migration levels, want 2", len(response.Prognoses))
+	}
+	for _, migrationLevel := range []string{"low", "high"} {
+		prognosis := response.Prognoses[migrationLevel]
+		checkPrognosis(t, migrationLevel, prognosis, 2030)
+		for _, dataPoint := range prognosis {
+			if len(dataPoint.Intervals) != 2 {
+				t.Fatalf("data point %s contains %d intervals, want 2", dataPoint.Date, len(dataPoint.Intervals))
+			}
+		}
+	}
+}
+
+func TestForecastRequestRejectsUnknownModel(t *testing.T) {
+	setUpForecastHandlers(t)
+
+	recorder := serveForecast(ForecastRequestV2, "key=03151&model=unknown")
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestForecastRequestWithBreakdown(t *testing.T) {
+	setUpForecastHandlers(t)
+
+	recorder := serveForecast(ForecastRequestV2, "key=03151&breakdown=true")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var response structs.ScenarioResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	prognosis, found := response.Breakdown["031510001001"]
+	if !found {
+		t.Fatalf("breakdown does not contain the municipality: %+v", response.Breakdown)
+	}
+	if prognosis.Error != nil || prognosis.Name != "Gifhorn" {
+		t.Errorf("unexpected prognosis %+v", prognosis)
+	}
+	checkPrognosis(t, "low", prognosis.Prognoses["low"], 2030)
+	if prognosis.DataQuality == nil || prognosis.DataQuality.Coverage != 1 {
+		t.Errorf("data quality of the municipality is missing: %+v", prognosis.DataQuality)
+	}
+}
+
+// queueFullForecaster calculates the first forecast with the stub backend and
+// rejects the following forecasts since the queue is full
+type queueFullForecaster struct {
+	calls *atomic.Int32
+}
+
+func (f queueFullForecaster) Forecast(ctx context.Context, input forecast.Input, options forecast.Options) (
+	*forecast.Result, error) {
+	if f.calls.Add(1) > 1 {
+		return nil, forecast.ErrQueueFull
+	}
+	return forecast.StubForecaster{}.Forecast(ctx, input, options)
+}
+
+func TestForecastRequestFailsIfBreakdownIsQueuedOut(t *testing.T) {
+	setUpForecastHandlers(t)
+	globals.Forecasters["queueFull"] = queueFullForecaster{calls: &atomic.Int32{}}
+	t.Cleanup(func() { delete(globals.Forecasters, "queueFull") })
+
+	recorder := serveForecast(ForecastRequestV2, "key=03151&breakdown=true&model=queueFull")
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want %d: %s", recorder.Code, http.StatusServiceUnavailable,
+			recorder.Body.String())
+	}
+	if !strings.Contains(recorder.Body.String(), "FORECAST_QUEUE_FULL") {
+		t.Errorf("response does not name the full queue: %s", recorder.Body.String())
+	}
+}
+
+func TestForecastRequestRejectsEmptyWindows(t *testing.T) {
+	setUpForecastHandlers(t)
+
+	tests := []struct {
+		query     string
+		parameter string
+	}{
+		{"key=03151&from=2021", "from"},
+		{"key=03151&to=2010", "to"},
+		{"key=03151&asOf=2010", "asOf"},
+		{"key=03151&from=2005&to=2010&asOf=2012", "to"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			recorder := serveForecast(ForecastRequestV2, test.query)
+			if recorder.Code != http.StatusBadRequest {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body.String())
+			}
+			body := recorder.Body.String()
+			if !strings.Contains(body, "INVALID_PARAMETER") || !strings.Contains(body, test.parameter+": ") {
+				t.Errorf("response does not name the parameter %q: %s", test.parameter, body)
+			}
+			if !strings.Contains(body, "from 2011 until 2020") {
+				t.Errorf("response does not name the recorded years: %s", body)
+			}
+		})
+	}
+}
+
+func TestForecastRequestValidatesUsageTypes(t *testing.T) {
+	setUpForecastHandlers(t)
+
+	recorder := serveForecast(ForecastRequestV2, "key=03151&usageType=households,industry")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = serveForecast(ForecastRequestV2, "key=03151&usageType=households&usageType=agriculture")
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body.String())
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "usageType: ") ||
+		!strings.Contains(body, "'agriculture'") {
+		t.Errorf("response does not name the usage type: %s", body)
+	}
+}
@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"microservice/globals"
+	"microservice/jobs"
+	requestErrors "microservice/request/error"
+	"microservice/structs"
+)
+
+// SubmitForecastJob handles requests which submit a new forecast job. The
+// parameters of the request are the same as the ones of the ForecastRequest
+// handler. The handler responds with the status of the job right away while the
+// forecast is calculated in the background
+func SubmitForecastJob(responseWriter http.ResponseWriter, request *http.Request) {
+	parameters, err := parseForecastParameters(request)
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+
+	job, err := globals.Jobs.Submit(func(ctx context.Context) (*structs.ScenarioResponse, error) {
+		outcome, err := calculateForecast(ctx, *parameters)
+		if err != nil {
+			return nil, err
+		}
+		return outcome.Response, nil
+	})
+	if errors.Is(err, jobs.ErrQueueFull) {
+		requestErrors.RespondWithError(buildRequestError(requestErrors.JobQueueFull), responseWriter)
+		return
+	}
+	if err != nil {
+		requestErrors.RespondWithInternalError(err, responseWriter)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	responseWriter.Header().Set("Location", fmt.Sprintf("jobs/%s", job.ID))
+	responseWriter.WriteHeader(http.StatusAccepted)
+	encodingError := json.NewEncoder(responseWriter).Encode(job)
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
+
+// ForecastJobStatus handles requests for the status of a forecast job
+func ForecastJobStatus(responseWriter http.ResponseWriter, request *http.Request) {
+	job, exists := globals.Jobs.Get(chi.URLParam(request, "jobID"))
+	if !exists {
+		requestErrors.RespondWithError(buildRequestError(requestErrors.JobNotFound), responseWriter)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	encodingError := json.NewEncoder(responseWriter).Encode(job)
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
+
+// ForecastJobResult handles requests for the result of a forecast job. If the
+// job failed, the error which let the job fail is sent back
+func ForecastJobResult(responseWriter http.ResponseWriter, request *http.Request) {
+	handleForecastJobResult(apiVersion1, responseWriter, request)
+}
+
+// ForecastJobResultV2 is the ForecastJobResult handler of the second API
+// version which sends back a forecast for every migration level of the
+// population prognosis
+func ForecastJobResultV2(responseWriter http.ResponseWriter, request *http.Request) {
+	handleForecastJobResult(apiVersion2, responseWriter, request)
+}
+
+// handleForecastJobResult sends back the result of a forecast job in the format
+// of the API version
+func handleForecastJobResult(version apiVersion, responseWriter http.ResponseWriter, request *http.Request) {
+	job, exists := globals.Jobs.Get(chi.URLParam(request, "jobID"))
+	if !exists {
+		requestErrors.RespondWithError(buildRequestError(requestErrors.JobNotFound), responseWriter)
+		return
+	}
+
+	switch job.Status {
+	case jobs.Failed:
+		requestErrors.RespondWithRequestError(job.Error, responseWriter)
+		return
+	case jobs.Queued, jobs.Running:
+		requestErrors.RespondWithError(buildRequestError(requestErrors.JobNotFinished), responseWriter)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	encodingError := json.NewEncoder(responseWriter).Encode(version.responseBody(job.Result()))
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"fmt"
+
+	"microservice/forecast"
+	"microservice/structs"
+)
+
+// The measures which may be requested for a forecast. The per-person water
+// usage is always calculated by the model while the total demand is derived
+// from it
+const (
+	measurePerCapita = "perCapita"
+	measureTotal     = "total"
+	measureBoth      = "both"
+)
+
+// totalDemands calculates the total water demand of every scenario contained
+// in the forecast. The per-person water usage of a year is multiplied with the
+// population of the scenario in the same year. The key of the mapping is the
+// name of the scenario
+func totalDemands(scenarios map[string][]structs.OutputDataPoint, input forecast.Input) (
+	map[string][]structs.OutputDataPoint, error) {
+	totals := make(map[string][]structs.OutputDataPoint)
+	for scenario, dataPoints := range scenarios {
+		populationByYear := make(map[int]float64)
+		for _, series := range [][]structs.InputDataPoint{input.CurrentPopulation, input.PopulationScenarios[scenario]} {
+			for _, dataPoint := range series {
+				year, err := dataPoint.Year()
+				if err != nil {
+					return nil, err
+				}
+				populationByYear[year] = dataPoint.Value
+			}
+		}
+
+		for _, dataPoint := range dataPoints {
+			year, err := dataPoint.Year()
+			if err != nil {
+				return nil, err
+			}
+			population, populationSet := populationByYear[year]
+			if !populationSet {
+				return nil, fmt.Errorf("%w: no population of scenario '%s' for %d", forecast.ErrSeriesLengthMismatch,
+					scenario, year)
+			}
+			totals[scenario] = append(totals[scenario], scaleDataPoint(dataPoint, population))
+		}
+	}
+	return totals, nil
+}
+
+// scaleDataPoint multiplies the forecast and all bounds of the data point with
+// the factor
+func scaleDataPoint(dataPoint structs.OutputDataPoint, factor float64) structs.OutputDataPoint {
+	scaledDataPoint := structs.OutputDataPoint{
+		Date:       dataPoint.Date,
+		LowerBound: dataPoint.LowerBound * factor,
+		Forecast:   dataPoint.Forecast * factor,
+		UpperBound: dataPoint.UpperBound * factor,
+	}
+	if dataPoint.Intervals != nil {
+		scaledDataPoint.Intervals = make(map[string]structs.Band)
+		for name, band := range dataPoint.Intervals {
+			scaledDataPoint.Intervals[name] = structs.Band{
+				LowerBound: band.LowerBound * factor,
+				UpperBound: band.UpperBound * factor,
+			}
+		}
+	}
+	return scaledDataPoint
+}
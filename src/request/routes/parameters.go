@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	requestErrors "microservice/request/error"
+)
+
+// queryParameter returns the first value of the query parameter which has been
+// put into the request context. The boolean indicates if the parameter is set
+func queryParameter(request *http.Request, name string) (string, bool) {
+	values := queryParameters(request, name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// queryParameters returns all values of the query parameter which has been put
+// into the request context
+func queryParameters(request *http.Request, name string) []string {
+	values, _ := request.Context().Value(name).([]string)
+	return values
+}
+
+// intParameter parses the query parameter as integer. If the parameter is not
+// set, the fallback is returned
+func intParameter(request *http.Request, name string, fallback int) (int, error) {
+	rawValue, isSet := queryParameter(request, name)
+	if !isSet {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(rawValue)
+	if err != nil {
+		return 0, invalidParameter(name, "expected an integer")
+	}
+	return value, nil
+}
+
+// floatParameter parses the query parameter as floating point number. If the
+// parameter is not set, nil is returned
+func floatParameter(request *http.Request, name string) (*float64, error) {
+	rawValue, isSet := queryParameter(request, name)
+	if !isSet {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return nil, invalidParameter(name, "expected a number")
+	}
+	return &value, nil
+}
+
+// boolParameter parses the query parameter as boolean. If the parameter is not
+// set, the fallback is returned
+func boolParameter(request *http.Request, name string, fallback bool) (bool, error) {
+	rawValue, isSet := queryParameter(request, name)
+	if !isSet {
+		return fallback, nil
+	}
+	value, err := strconv.ParseBool(rawValue)
+	if err != nil {
+		return false, invalidParameter(name, "expected true or false")
+	}
+	return value, nil
+}
+
+// dateParameter parses the query parameter as date in the format YYYY-MM-DD.
+// If the parameter is not set, nil is returned
+func dateParameter(request *http.Request, name string) (*time.Time, error) {
+	rawValue, isSet := queryParameter(request, name)
+	if !isSet {
+		return nil, nil
+	}
+	value, err := time.Parse("2006-01-02", rawValue)
+	if err != nil {
+		return nil, invalidParameter(name, "expected a date in the format YYYY-MM-DD")
+	}
+	return &value, nil
+}
+
+// invalidParameter builds the request error sent back if a parameter contains
+// an invalid value
+func invalidParameter(name string, reason string) error {
+	return buildRequestErrorWithDetails(requestErrors.InvalidParameter, fmt.Sprintf("%s: %s", name, reason))
+}
+
+// buildRequestErrorWithDetails builds the request error for the supplied error
+// code and appends the details to its description
+func buildRequestErrorWithDetails(code string, details string) error {
+	requestError, err := requestErrors.BuildRequestError(code)
+	if err != nil {
+		return err
+	}
+	requestError.ErrorDescription = fmt.Sprintf("%s: %s", requestError.ErrorDescription, details)
+	return requestError
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"microservice/globals"
+	"microservice/history"
+	requestErrors "microservice/request/error"
+)
+
+// maximumRunListLimit is the maximum number of forecast runs listed at once
+const maximumRunListLimit = 1000
+
+// ListForecastRuns handles requests listing the recorded forecast runs. The runs
+// may be filtered by region using the `key` parameter and by their creation
+// date using the `from` and `to` parameters
+func ListForecastRuns(responseWriter http.ResponseWriter, request *http.Request) {
+	filter := history.Filter{Keys: queryParameters(request, "key")}
+
+	var err error
+	filter.From, err = dateParameter(request, "from")
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+	filter.To, err = dateParameter(request, "to")
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+	if filter.To != nil {
+		// the end date is inclusive
+		endOfDay := filter.To.Add(24 * time.Hour)
+		filter.To = &endOfDay
+	}
+	filter.Limit, err = intParameter(request, "limit", 100)
+	if err != nil {
+		requestErrors.RespondWithError(err, responseWriter)
+		return
+	}
+	if filter.Limit < 1 || filter.Limit > maximumRunListLimit {
+		requestErrors.RespondWithError(invalidParameter("limit", "expected a value between 1 and 1000"),
+			responseWriter)
+		return
+	}
+
+	runs, err := globals.History.List(request.Context(), filter)
+	if err != nil {
+		requestErrors.RespondWithInternalError(err, responseWriter)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	encodingError := json.NewEncoder(responseWriter).Encode(runs)
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
+
+// GetForecastRun handles requests for a single recorded forecast run including
+// its input data and its result
+func GetForecastRun(responseWriter http.ResponseWriter, request *http.Request) {
+	run, err := globals.History.Get(request.Context(), chi.URLParam(request, "runID"))
+	if errors.Is(err, history.ErrRunNotFound) {
+		requestErrors.RespondWithError(buildRequestError(requestErrors.RunNotFound), responseWriter)
+		return
+	}
+	if err != nil {
+		requestErrors.RespondWithInternalError(err, responseWriter)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	encodingError := json.NewEncoder(responseWriter).Encode(run)
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
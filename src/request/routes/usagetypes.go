@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/lib/pq"
+
+	"microservice/globals"
+	requestErrors "microservice/request/error"
+	"microservice/utils"
+	"microservice/vars"
+)
+
+// ListUsageTypes handles requests listing the usage types of the recorded water
+// usages. The usage types may be restricted to the areas selected by the `key`
+// parameter
+func ListUsageTypes(responseWriter http.ResponseWriter, request *http.Request) {
+	var municipalityKeys []string
+	if shapeKeys := queryParameters(request, "key"); len(shapeKeys) > 0 {
+		logger := vars.HttpLogger.With().Str("requestID", middleware.GetReqID(request.Context())).Logger()
+		var err error
+		municipalityKeys, err = resolveMunicipalityKeys(request.Context(), logger, shapeKeys)
+		if err != nil {
+			requestErrors.RespondWithInternalError(err, responseWriter)
+			return
+		}
+		if len(municipalityKeys) == 0 {
+			requestErrors.RespondWithError(buildRequestError(requestErrors.NoWaterUsageData), responseWriter)
+			return
+		}
+	}
+
+	usageTypes, err := getUsageTypes(request.Context(), municipalityKeys)
+	if err != nil {
+		requestErrors.RespondWithInternalError(err, responseWriter)
+		return
+	}
+	if usageTypes == nil {
+		usageTypes = []string{}
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/json")
+	encodingError := json.NewEncoder(responseWriter).Encode(usageTypes)
+	if encodingError != nil {
+		requestErrors.RespondWithInternalError(encodingError, responseWriter)
+		return
+	}
+}
+
+// getUsageTypes returns the usage types of the water usages recorded for the
+// municipalities. Without municipality keys, the usage types of all
+// municipalities are returned
+func getUsageTypes(ctx context.Context, municipalityKeys []string) ([]string, error) {
+	rows, err := vars.SqlQueries.QueryContext(ctx, globals.Db, "get-usage-types", pq.Array(municipalityKeys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usageTypes []string
+	for rows.Next() {
+		var usageType string
+		if err := rows.Scan(&usageType); err != nil {
+			return nil, err
+		}
+		usageTypes = append(usageTypes, usageType)
+	}
+	return usageTypes, rows.Err()
+}
+
+// validateUsageTypes checks that every usage type selected in the request has
+// been recorded for the municipalities. Otherwise, the usage type is either
+// unknown or the municipalities do not contain any water usages of it
+func validateUsageTypes(ctx context.Context, municipalityKeys []string, usageTypes []string) error {
+	if len(usageTypes) == 0 {
+		return nil
+	}
+	recordedUsageTypes, err := getUsageTypes(ctx, municipalityKeys)
+	if err != nil {
+		return err
+	}
+	for _, usageType := range usageTypes {
+		if !utils.ArrayContains(recordedUsageTypes, usageType) {
+			return invalidParameter("usageType", fmt.Sprintf(
+				"the usage type '%s' has not been recorded for the selected areas", usageType))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"microservice/structs"
+)
+
+// apiVersion identifies the version of the API a handler belongs to. The
+// versions only differ in the format of the forecasts which are sent back
+type apiVersion int
+
+const (
+	// apiVersion1 sends back the low, medium and high migration levels as
+	// separate fields of the response
+	apiVersion1 apiVersion = iota + 1
+
+	// apiVersion2 sends back every migration level found in the population
+	// prognosis in a mapping keyed by the migration level
+	apiVersion2
+)
+
+// responseBody returns the body which is sent back for the forecast in the
+// format of the API version
+func (v apiVersion) responseBody(response *structs.ScenarioResponse) interface{} {
+	if v == apiVersion1 {
+		return response.Legacy()
+	}
+	return response
+}
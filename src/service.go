@@ -38,6 +38,23 @@ func main() {
 	router.Use(middleware2.AdditionalResponseHeaders)
 	router.Use(middleware2.ParseQueryParametersToContext)
 	router.HandleFunc("/", routes.ForecastRequest)
+	router.Post("/custom", routes.CustomForecastRequest)
+	router.Get("/backtest", routes.BacktestRequest)
+	router.Get("/usage-types", routes.ListUsageTypes)
+	router.Post("/jobs", routes.SubmitForecastJob)
+	router.Get("/jobs/{jobID}", routes.ForecastJobStatus)
+	router.Get("/jobs/{jobID}/result", routes.ForecastJobResult)
+	router.Route("/v2", func(v2Router chi.Router) {
+		v2Router.HandleFunc("/", routes.ForecastRequestV2)
+		v2Router.Post("/custom", routes.CustomForecastRequestV2)
+		v2Router.Post("/jobs", routes.SubmitForecastJob)
+		v2Router.Get("/jobs/{jobID}", routes.ForecastJobStatus)
+		v2Router.Get("/jobs/{jobID}/result", routes.ForecastJobResultV2)
+	})
+	if globals.History != nil {
+		router.Get("/runs", routes.ListForecastRuns)
+		router.Get("/runs/{runID}", routes.GetForecastRun)
+	}
 	router.HandleFunc("/healthcheck", routes.HealthCheck)
 
 	// Configure the HTTP server
@@ -1,5 +1,14 @@
 package structs
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"microservice/request/enums"
+)
+
 // ScopeInformation contains the information about the scope for this service
 type ScopeInformation struct {
 	JSONSchema       string `json:"$schema"`
@@ -17,21 +26,516 @@ type RequestError struct {
 	ErrorDescription string `json:"errorDescription"`
 }
 
+// Error returns the error code and the description of the request error which
+// allows passing a request error as error value
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode, e.ErrorDescription)
+}
+
 // InputDataPoint contains the water usage of a single year
 type InputDataPoint struct {
 	Date  string  `json:"ds"`
 	Value float64 `json:"y"`
 }
 
+// Year returns the year the data point belongs to
+func (p InputDataPoint) Year() (int, error) {
+	return strconv.Atoi(strings.Split(p.Date, "-")[0])
+}
+
+// Band contains the bounds of a prediction interval
+type Band struct {
+	LowerBound float64 `json:"lower"`
+	UpperBound float64 `json:"upper"`
+}
+
 type OutputDataPoint struct {
 	Date       string  `json:"ds"`
 	LowerBound float64 `json:"lower"`
 	Forecast   float64 `json:"forecast"`
 	UpperBound float64 `json:"upper"`
+	// Intervals contains a band for every requested interval width. The key of
+	// the mapping is the width of the interval (e.g., "0.95")
+	Intervals map[string]Band `json:"intervals,omitempty"`
+}
+
+// Year returns the year the data point belongs to
+func (p OutputDataPoint) Year() (int, error) {
+	return strconv.Atoi(strings.Split(p.Date, "-")[0])
+}
+
+// ComponentPoint contains the components of the total water usage which the
+// forecast of a single year is composed of
+type ComponentPoint struct {
+	Date  string  `json:"ds"`
+	Trend float64 `json:"trend"`
+	// Effects contains the seasonal and regressor effects which are added to
+	// the trend. The key of the mapping is the name of the effect (e.g.,
+	// "yearly" or "population")
+	Effects map[string]float64 `json:"effects,omitempty"`
+}
+
+// FittedPoint compares the total water usage fitted by the model for a year
+// of the recorded water usages with the recorded water usage
+type FittedPoint struct {
+	Date       string  `json:"ds"`
+	Actual     float64 `json:"actual"`
+	Fitted     float64 `json:"fitted"`
+	LowerBound float64 `json:"lower"`
+	UpperBound float64 `json:"upper"`
+}
+
+// ModelOptions configures the trend and the seasonality of the model which
+// calculates a forecast
+type ModelOptions struct {
+	// Preset is the name of the preset the options are based on
+	Preset string `json:"preset"`
+
+	// Growth selects the trend of the model. Either "linear" or "logistic"
+	Growth string `json:"growth"`
+
+	// Cap is the saturating maximum of the total water usage. The cap is
+	// required for logistic growth
+	Cap *float64 `json:"cap,omitempty"`
+
+	// Floor is the saturating minimum of the total water usage. The floor may
+	// only be set for logistic growth
+	Floor *float64 `json:"floor,omitempty"`
+
+	// YearlySeasonality enables the yearly seasonal component of the model
+	YearlySeasonality bool `json:"yearlySeasonality"`
+
+	// WeeklySeasonality enables the weekly seasonal component of the model
+	WeeklySeasonality bool `json:"weeklySeasonality"`
+
+	// DailySeasonality enables the daily seasonal component of the model
+	DailySeasonality bool `json:"dailySeasonality"`
+
+	// ChangepointPriorScale controls how flexible the trend of the model is
+	ChangepointPriorScale float64 `json:"changepointPriorScale"`
+
+	// Changepoints contains the years at which the trend may change. If no
+	// years are set, the model selects the changepoints itself
+	Changepoints []int `json:"changepoints,omitempty"`
+
+	// PopulationMode selects how the population enters the model. Either
+	// "division" or "regressor"
+	PopulationMode string `json:"populationMode"`
+}
+
+// Metadata describes the settings a forecast has been calculated with
+type Metadata struct {
+	// Model is the name of the model backend which calculated the forecast
+	Model string `json:"model"`
+
+	// Horizon is the number of years forecast after the last year with water
+	// usage data
+	Horizon int `json:"horizon"`
+
+	// Until is the last year contained in the forecast
+	Until int `json:"until"`
+
+	// IntervalWidths contains the widths of the calculated prediction
+	// intervals. The bounds of a data point belong to the first width
+	IntervalWidths []float64 `json:"intervalWidths"`
+
+	// ModelOptions contains the model options which have been applied
+	ModelOptions *ModelOptions `json:"modelOptions,omitempty"`
+
+	// GroupBy is the administrative level by which the municipalities have
+	// been grouped
+	GroupBy string `json:"groupBy,omitempty"`
+
+	// Include contains the additional outputs of the model which have been
+	// requested (e.g., "components" or "fitted")
+	Include []string `json:"include,omitempty"`
+
+	// Measure is the measure of the forecast. Either "perCapita", "total" or
+	// "both"
+	Measure string `json:"measure,omitempty"`
+
+	// UsageTypes contains the usage types of the water usages the model has
+	// been fitted on. If empty, the water usages of all usage types have been
+	// used
+	UsageTypes []string `json:"usageTypes,omitempty"`
+
+	// TrainingWindow describes the water usages the model has been fitted on
+	TrainingWindow *TrainingWindow `json:"trainingWindow,omitempty"`
+
+	// Outliers describes the outliers detected in the water usages if the
+	// detection has been requested
+	Outliers *OutlierReport `json:"outliers,omitempty"`
+
+	// DataQuality describes the gaps in the recorded data and how they have
+	// been handled
+	DataQuality *DataQuality `json:"dataQuality,omitempty"`
+}
+
+// DataQuality describes the quality of the recorded data a forecast has been
+// calculated from
+type DataQuality struct {
+	// GapPolicy is the policy which has been applied to the gaps. Either
+	// "interpolate", "reject" or "drop"
+	GapPolicy string `json:"gapPolicy"`
+
+	// Coverage is the share of the years of the water usages which contain a
+	// water usage and a positive population
+	Coverage float64 `json:"coverage"`
+
+	Warnings []DataWarning `json:"warnings"`
+}
+
+// DataWarning describes a problem found in the recorded data
+type DataWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Years contains the years affected by the problem
+	Years []int `json:"years,omitempty"`
+}
+
+// OutlierOptions configures the detection of outliers in the recorded
+// per-person water usages
+type OutlierOptions struct {
+	// Method is the robust statistic the outliers are detected with. Either
+	// "mad" or "iqr"
+	Method string `json:"method"`
+
+	// Threshold is the multiple of the spread a value may deviate before it is
+	// flagged as outlier
+	Threshold float64 `json:"threshold"`
+
+	// Action is applied to the outliers before fitting the model. Either
+	// "keep", "drop" or "winsorize"
+	Action string `json:"action"`
+}
+
+// Outlier describes a year of the recorded water usages which has been flagged
+// as outlier
+type Outlier struct {
+	Year int `json:"year"`
+
+	// Value is the recorded per-person water usage of the year
+	Value float64 `json:"value"`
+
+	// Replacement is the per-person water usage the value has been replaced
+	// with. It is only set for winsorized outliers
+	Replacement *float64 `json:"replacement,omitempty"`
+}
+
+// OutlierReport lists the outliers detected in the recorded water usages and
+// the action which has been applied to them
+type OutlierReport struct {
+	OutlierOptions
+
+	// LowerBound and UpperBound limit the per-person water usages which are
+	// no outliers
+	LowerBound float64 `json:"lower"`
+	UpperBound float64 `json:"upper"`
+
+	Outliers []Outlier `json:"outliers"`
+}
+
+// TrainingWindow describes the years of the water usages a model has been
+// fitted on
+type TrainingWindow struct {
+	// From is the first year of the water usages
+	From int `json:"from"`
+
+	// To is the last year of the water usages
+	To int `json:"to"`
+
+	// AsOf is the year the forecast has been calculated as of. The data
+	// recorded after the year has been ignored
+	AsOf int `json:"asOf,omitempty"`
+}
+
+// PopulationValue contains the population of a single year
+type PopulationValue struct {
+	Year       int     `json:"year"`
+	Population float64 `json:"population"`
+}
+
+// CustomScenario contains a population development supplied by a client
+type CustomScenario struct {
+	// Base is the migration level the scenario is based on. If set, the
+	// population values are added to the population of the migration level
+	Base string `json:"base,omitempty"`
+
+	// Population contains the population values of the scenario. If the
+	// scenario is based on a migration level, the values contain the
+	// additional inhabitants of a year
+	Population []PopulationValue `json:"population"`
+}
+
+// ScenarioResponse contains a forecast for every population scenario. The
+// response is sent by the second version of the API and is used internally to
+// store forecasts. The first version of the API sends the Response built by
+// the Legacy method
+type ScenarioResponse struct {
+	// Prognoses contains the forecast for every migration level found in the
+	// population prognosis. The key of the mapping is the migration level
+	Prognoses map[string][]OutputDataPoint `json:"prognoses"`
+
+	// CustomPrognoses contains the forecast for every custom population
+	// scenario supplied in the request. The key of the mapping is the name
+	// of the scenario
+	CustomPrognoses map[string][]OutputDataPoint `json:"customPrognoses,omitempty"`
+
+	// Breakdown contains the forecast of every municipality of the selected
+	// areas if a breakdown has been requested. The key of the mapping is the
+	// key of the municipality
+	Breakdown map[string]AreaPrognosis `json:"breakdown,omitempty"`
+
+	// Groups contains the forecast of every group of municipalities if a
+	// grouping has been requested. The key of the mapping is the key of the
+	// area the municipalities of a group belong to
+	Groups map[string]AreaPrognosis `json:"groups,omitempty"`
+
+	// Totals contains the total water demand for every population scenario if
+	// it has been requested. The total demand is the per-person water usage
+	// multiplied with the population of the scenario. The key of the mapping
+	// is the name of the scenario
+	Totals map[string][]OutputDataPoint `json:"totals,omitempty"`
+
+	// Components contains the components of the total water usage for every
+	// population scenario if they have been requested. The key of the mapping
+	// is the name of the scenario
+	Components map[string][]ComponentPoint `json:"components,omitempty"`
+
+	// Fitted contains the total water usages fitted by the model for the
+	// years of the recorded water usages if they have been requested
+	Fitted []FittedPoint `json:"fitted,omitempty"`
+
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// AreaPrognosis contains the forecast of a part of the selected areas. If the
+// forecast could not be calculated, the error is set instead
+type AreaPrognosis struct {
+	// Name is the name of the area
+	Name string `json:"name,omitempty"`
+
+	// MunicipalityKeys contains the keys of the municipalities forecast
+	// together
+	MunicipalityKeys []string `json:"municipalityKeys"`
+
+	// Prognoses contains the forecast for every migration level. The key of
+	// the mapping is the migration level
+	Prognoses map[string][]OutputDataPoint `json:"prognoses,omitempty"`
+
+	// Totals contains the total water demand for every migration level if it
+	// has been requested. The key of the mapping is the migration level
+	Totals map[string][]OutputDataPoint `json:"totals,omitempty"`
+
+	// Outliers lists the outliers detected in the water usages of the area if
+	// the detection has been requested
+	Outliers *OutlierReport `json:"outliers,omitempty"`
+
+	// DataQuality describes the gaps found in the recorded data of the area
+	DataQuality *DataQuality `json:"dataQuality,omitempty"`
+
+	// Error describes why the forecast could not be calculated
+	Error *RequestError `json:"error,omitempty"`
 }
 
+// LegacyAreaPrognosis is the AreaPrognosis sent by the first version of the API
+type LegacyAreaPrognosis struct {
+	Name                string            `json:"name,omitempty"`
+	MunicipalityKeys    []string          `json:"municipalityKeys"`
+	LowMigrationData    []OutputDataPoint `json:"lowMigrationPrognosis,omitempty"`
+	MediumMigrationData []OutputDataPoint `json:"mediumMigrationPrognosis,omitempty"`
+	HighMigrationData   []OutputDataPoint `json:"highMigrationPrognosis,omitempty"`
+	// Totals contains the total water demand for every migration level if it
+	// has been requested
+	Totals      map[string][]OutputDataPoint `json:"totals,omitempty"`
+	Outliers    *OutlierReport               `json:"outliers,omitempty"`
+	DataQuality *DataQuality                 `json:"dataQuality,omitempty"`
+	Error       *RequestError                `json:"error,omitempty"`
+}
+
+// UnmarshalJSON decodes a ScenarioResponse. Documents in the format of the
+// first API version (e.g., forecasts stored before the second version has been
+// introduced) are converted while decoding
+func (r *ScenarioResponse) UnmarshalJSON(data []byte) error {
+	// the alias type prevents calling this method recursively
+	type scenarioResponse ScenarioResponse
+	if err := json.Unmarshal(data, (*scenarioResponse)(r)); err != nil {
+		return err
+	}
+	if r.Prognoses != nil {
+		return nil
+	}
+
+	var legacyResponse Response
+	if err := json.Unmarshal(data, &legacyResponse); err != nil {
+		return err
+	}
+	r.Prognoses = migrationLevelPrognoses(legacyResponse.LowMigrationData, legacyResponse.MediumMigrationData,
+		legacyResponse.HighMigrationData)
+	if r.Prognoses == nil {
+		r.Prognoses = make(map[string][]OutputDataPoint)
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes an AreaPrognosis. Area prognoses in the format of the
+// first API version are converted while decoding
+func (p *AreaPrognosis) UnmarshalJSON(data []byte) error {
+	// the alias type prevents calling this method recursively
+	type areaPrognosis AreaPrognosis
+	if err := json.Unmarshal(data, (*areaPrognosis)(p)); err != nil {
+		return err
+	}
+	if p.Prognoses != nil {
+		return nil
+	}
+
+	var legacyPrognosis LegacyAreaPrognosis
+	if err := json.Unmarshal(data, &legacyPrognosis); err != nil {
+		return err
+	}
+	p.Prognoses = migrationLevelPrognoses(legacyPrognosis.LowMigrationData, legacyPrognosis.MediumMigrationData,
+		legacyPrognosis.HighMigrationData)
+	return nil
+}
+
+// migrationLevelPrognoses maps the prognoses of the first API version to their
+// migration levels. Missing prognoses are left out. If no prognosis is set,
+// nil is returned
+func migrationLevelPrognoses(low, medium, high []OutputDataPoint) map[string][]OutputDataPoint {
+	var prognoses map[string][]OutputDataPoint
+	for level, dataPoints := range map[enums.MigrationLevel][]OutputDataPoint{
+		enums.LowMigrationLevel:    low,
+		enums.MediumMigrationLevel: medium,
+		enums.HighMigrationLevel:   high,
+	} {
+		if dataPoints == nil {
+			continue
+		}
+		if prognoses == nil {
+			prognoses = make(map[string][]OutputDataPoint)
+		}
+		prognoses[string(level)] = dataPoints
+	}
+	return prognoses
+}
+
+// Legacy converts the response into the format of the first API version which
+// contains the low, medium and high migration levels only. The prognoses of
+// other migration levels are dropped
+func (r ScenarioResponse) Legacy() *Response {
+	return &Response{
+		LowMigrationData:    r.Prognoses[string(enums.LowMigrationLevel)],
+		MediumMigrationData: r.Prognoses[string(enums.MediumMigrationLevel)],
+		HighMigrationData:   r.Prognoses[string(enums.HighMigrationLevel)],
+		CustomPrognoses:     r.CustomPrognoses,
+		Breakdown:           legacyAreaPrognoses(r.Breakdown),
+		Groups:              legacyAreaPrognoses(r.Groups),
+		Totals:              r.Totals,
+		Components:          r.Components,
+		Fitted:              r.Fitted,
+		Metadata:            r.Metadata,
+	}
+}
+
+// legacyAreaPrognoses converts the area prognoses into the format of the first
+// API version
+func legacyAreaPrognoses(prognoses map[string]AreaPrognosis) map[string]LegacyAreaPrognosis {
+	if prognoses == nil {
+		return nil
+	}
+	legacyPrognoses := make(map[string]LegacyAreaPrognosis)
+	for key, prognosis := range prognoses {
+		legacyPrognoses[key] = LegacyAreaPrognosis{
+			Name:                prognosis.Name,
+			MunicipalityKeys:    prognosis.MunicipalityKeys,
+			LowMigrationData:    prognosis.Prognoses[string(enums.LowMigrationLevel)],
+			MediumMigrationData: prognosis.Prognoses[string(enums.MediumMigrationLevel)],
+			HighMigrationData:   prognosis.Prognoses[string(enums.HighMigrationLevel)],
+			Totals:              prognosis.Totals,
+			Outliers:            prognosis.Outliers,
+			DataQuality:         prognosis.DataQuality,
+			Error:               prognosis.Error,
+		}
+	}
+	return legacyPrognoses
+}
+
+// Response is the response sent by the first version of the API
 type Response struct {
 	LowMigrationData    []OutputDataPoint `json:"lowMigrationPrognosis"`
 	MediumMigrationData []OutputDataPoint `json:"mediumMigrationPrognosis"`
 	HighMigrationData   []OutputDataPoint `json:"highMigrationPrognosis"`
+	// CustomPrognoses contains the forecast for every custom population
+	// scenario supplied in the request. The key of the mapping is the name
+	// of the scenario
+	CustomPrognoses map[string][]OutputDataPoint `json:"customPrognoses,omitempty"`
+	// Breakdown contains the forecast of every municipality of the selected
+	// areas if a breakdown has been requested
+	Breakdown map[string]LegacyAreaPrognosis `json:"breakdown,omitempty"`
+	// Groups contains the forecast of every group of municipalities if a
+	// grouping has been requested
+	Groups map[string]LegacyAreaPrognosis `json:"groups,omitempty"`
+	// Totals contains the total water demand for every population scenario if
+	// it has been requested
+	Totals map[string][]OutputDataPoint `json:"totals,omitempty"`
+	// Components contains the components of the total water usage for every
+	// population scenario if they have been requested
+	Components map[string][]ComponentPoint `json:"components,omitempty"`
+	// Fitted contains the total water usages fitted by the model for the
+	// years of the recorded water usages if they have been requested
+	Fitted   []FittedPoint `json:"fitted,omitempty"`
+	Metadata *Metadata     `json:"metadata,omitempty"`
+}
+
+// AccuracyMetrics describes how well a forecast matches the recorded values
+type AccuracyMetrics struct {
+	// Observations is the number of recorded values the forecast has been
+	// compared to
+	Observations int `json:"observations"`
+
+	// MeanAbsoluteError is the mean of the absolute forecast errors
+	MeanAbsoluteError float64 `json:"mae"`
+
+	// RootMeanSquaredError is the root of the mean of the squared forecast
+	// errors
+	RootMeanSquaredError float64 `json:"rmse"`
+
+	// MeanAbsolutePercentageError is the mean of the absolute forecast errors
+	// relative to the recorded values in percent. Recorded values of zero are
+	// left out. If every recorded value is zero, the error is nil
+	MeanAbsolutePercentageError *float64 `json:"mape"`
+
+	// Coverage contains the share of the recorded values which lie within
+	// the prediction interval of every interval width. The key of the mapping
+	// is the width of the interval
+	Coverage map[string]float64 `json:"coverage"`
+}
+
+// BacktestPoint compares the forecast of a held-out year with the recorded
+// per-person water usage of the year
+type BacktestPoint struct {
+	Date       string  `json:"ds"`
+	Actual     float64 `json:"actual"`
+	Forecast   float64 `json:"forecast"`
+	LowerBound float64 `json:"lower"`
+	UpperBound float64 `json:"upper"`
+}
+
+// BacktestCutoff contains the results of a forecast which has been fitted on
+// the water usages recorded until the cutoff year. If the forecast could not be
+// calculated, the error is set instead
+type BacktestCutoff struct {
+	Cutoff  int              `json:"cutoff"`
+	Metrics *AccuracyMetrics `json:"metrics,omitempty"`
+	Points  []BacktestPoint  `json:"points,omitempty"`
+	Error   *RequestError    `json:"error,omitempty"`
+}
+
+// BacktestResult contains the results of every cutoff year and the metrics of
+// all held-out years of the cutoffs together
+type BacktestResult struct {
+	Cutoffs  []BacktestCutoff `json:"cutoffs"`
+	Overall  *AccuracyMetrics `json:"overall"`
+	Metadata *Metadata        `json:"metadata,omitempty"`
 }
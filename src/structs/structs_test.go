@@ -0,0 +1,120 @@
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// prognosis builds a prognosis with a single data point containing the value
+func prognosis(value float64) []OutputDataPoint {
+	return []OutputDataPoint{{Date: "2030-12-31", LowerBound: value - 1, Forecast: value, UpperBound: value + 1}}
+}
+
+// levels returns the sorted migration levels of the prognoses
+func levels(prognoses map[string][]OutputDataPoint) []string {
+	var migrationLevels []string
+	for level := range prognoses {
+		migrationLevels = append(migrationLevels, level)
+	}
+	sort.Strings(migrationLevels)
+	return migrationLevels
+}
+
+// roundTrip encodes the value and decodes it into a ScenarioResponse
+func roundTrip(t *testing.T, value interface{}) ScenarioResponse {
+	t.Helper()
+	document, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response ScenarioResponse
+	if err := json.Unmarshal(document, &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestScenarioResponseKeepsEveryMigrationLevel(t *testing.T) {
+	original := ScenarioResponse{
+		Prognoses: map[string][]OutputDataPoint{"low": prognosis(1), "medium": prognosis(2), "extreme": prognosis(4)},
+		Breakdown: map[string]AreaPrognosis{
+			"031510001001": {MunicipalityKeys: []string{"031510001001"}, Prognoses: map[string][]OutputDataPoint{
+				"extreme": prognosis(5),
+			}},
+		},
+	}
+
+	decoded := roundTrip(t, original)
+	if fmt.Sprint(decoded.Prognoses) != fmt.Sprint(original.Prognoses) {
+		t.Errorf("got prognoses %v, want %v", decoded.Prognoses, original.Prognoses)
+	}
+	if fmt.Sprint(decoded.Breakdown) != fmt.Sprint(original.Breakdown) {
+		t.Errorf("got breakdown %v, want %v", decoded.Breakdown, original.Breakdown)
+	}
+}
+
+func TestScenarioResponseConvertsLegacyDocuments(t *testing.T) {
+	legacy := Response{
+		LowMigrationData:  prognosis(1),
+		HighMigrationData: prognosis(3),
+		Breakdown: map[string]LegacyAreaPrognosis{
+			"031510001001": {MunicipalityKeys: []string{"031510001001"}, MediumMigrationData: prognosis(2)},
+			"031510002002": {MunicipalityKeys: []string{"031510002002"}, Error: &RequestError{ErrorCode: "failed"}},
+		},
+		Metadata: &Metadata{Model: "prophet"},
+	}
+
+	decoded := roundTrip(t, legacy)
+	if got := levels(decoded.Prognoses); fmt.Sprint(got) != "[high low]" {
+		t.Fatalf("got migration levels %v, want [high low]", got)
+	}
+	if decoded.Prognoses["low"][0].Forecast != 1 || decoded.Prognoses["high"][0].Forecast != 3 {
+		t.Errorf("unexpected prognoses %v", decoded.Prognoses)
+	}
+	if decoded.Metadata == nil || decoded.Metadata.Model != "prophet" {
+		t.Errorf("metadata has not been decoded: %+v", decoded.Metadata)
+	}
+
+	area := decoded.Breakdown["031510001001"]
+	if got := levels(area.Prognoses); fmt.Sprint(got) != "[medium]" || area.Prognoses["medium"][0].Forecast != 2 {
+		t.Errorf("got area prognoses %v, want the medium migration level", area.Prognoses)
+	}
+	failedArea := decoded.Breakdown["031510002002"]
+	if failedArea.Prognoses != nil || failedArea.Error == nil {
+		t.Errorf("failed area has not been decoded as failure: %+v", failedArea)
+	}
+}
+
+func TestLegacyDropsOtherMigrationLevels(t *testing.T) {
+	response := ScenarioResponse{
+		Prognoses: map[string][]OutputDataPoint{
+			"low": prognosis(1), "medium": prognosis(2), "high": prognosis(3), "extreme": prognosis(4),
+		},
+		Groups: map[string]AreaPrognosis{
+			"03151": {MunicipalityKeys: []string{"031510001001"}, Prognoses: map[string][]OutputDataPoint{
+				"high": prognosis(6), "extreme": prognosis(7),
+			}},
+		},
+	}
+
+	legacy := response.Legacy()
+	if legacy.LowMigrationData[0].Forecast != 1 || legacy.MediumMigrationData[0].Forecast != 2 ||
+		legacy.HighMigrationData[0].Forecast != 3 {
+		t.Errorf("unexpected legacy prognoses %+v", legacy)
+	}
+	if group := legacy.Groups["03151"]; group.HighMigrationData[0].Forecast != 6 || group.LowMigrationData != nil {
+		t.Errorf("unexpected legacy group %+v", group)
+	}
+
+	// converting the legacy response back only restores the migration levels
+	// of the first API version
+	decoded := roundTrip(t, legacy)
+	if got := levels(decoded.Prognoses); fmt.Sprint(got) != "[high low medium]" {
+		t.Errorf("got migration levels %v, want [high low medium]", got)
+	}
+	if got := levels(decoded.Groups["03151"].Prognoses); fmt.Sprint(got) != "[high]" {
+		t.Errorf("got group migration levels %v, want [high]", got)
+	}
+}
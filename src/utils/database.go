@@ -9,6 +9,7 @@ import (
 // ReadDataForProphet accepts a Rows object which has the following columns: year,
 // data. This data is then transformed into a dataset to handle the access better
 func ReadDataForProphet(rows *sql.Rows) ([]structs.InputDataPoint, error) {
+	defer rows.Close()
 	var dataset []structs.InputDataPoint
 	for rows.Next() {
 		var year int
@@ -27,5 +28,5 @@ func ReadDataForProphet(rows *sql.Rows) ([]structs.InputDataPoint, error) {
 			},
 		)
 	}
-	return dataset, nil
+	return dataset, rows.Err()
 }
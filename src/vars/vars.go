@@ -5,6 +5,7 @@ package vars
 import (
 	"database/sql"
 	"github.com/rs/zerolog"
+	"time"
 
 	"github.com/qustavo/dotsql"
 
@@ -50,6 +51,18 @@ var (
 
 	// QueryFilePath specifies from where the service shall load the sql queries
 	QueryFilePath string = "/res/queries.sql"
+
+	// RetryAfter is the number of seconds a client is asked to wait before
+	// retrying a request which has been rejected since the service is overloaded
+	RetryAfter int = 30
+
+	// ForecastTimeout is the maximum duration a single forecast may take
+	// including the database queries and the execution of the model
+	ForecastTimeout time.Duration = 10 * time.Minute
+
+	// ForecastConcurrency is the number of forecasts which are calculated at
+	// the same time by a model backend
+	ForecastConcurrency int = 2
 )
 
 // ===== Globally used variables =====
@@ -0,0 +1,98 @@
+// Package workspace manages the private directories in which the model
+// processes are executed. Every run gets its own directory which is removed
+// once the run has finished, regardless of how the run finished. Directories of
+// failed runs may be moved into a quarantine directory for debugging instead
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+)
+
+// Manager creates the workspaces below its root directory
+type Manager struct {
+	// Root is the directory in which the workspaces are created
+	Root string
+
+	// QuarantineDirectory is the directory into which the workspaces of failed
+	// runs are moved. If the directory is empty, the workspaces of failed runs
+	// are removed as well
+	QuarantineDirectory string
+
+	// Logger is used to report workspaces which could not be cleaned up
+	Logger zerolog.Logger
+}
+
+// Workspace is a private directory used by a single run
+type Workspace struct {
+	// Path is the absolute path of the workspace directory
+	Path string
+}
+
+// File returns the path of a file with the supplied name inside the workspace
+func (w Workspace) File(name string) string {
+	return filepath.Join(w.Path, name)
+}
+
+// Run creates a new workspace and executes the supplied function in it. The
+// workspace is removed once the function returns or panics. If the function
+// fails or panics, the workspace is moved into the quarantine directory
+// instead. Runs which failed since the context has been cancelled are not
+// quarantined
+func (m *Manager) Run(ctx context.Context, run func(workspace Workspace) error) (err error) {
+	err = os.MkdirAll(m.Root, 0o700)
+	if err != nil {
+		return fmt.Errorf("unable to create workspace root: %w", err)
+	}
+	path, err := os.MkdirTemp(m.Root, "run-")
+	if err != nil {
+		return fmt.Errorf("unable to create workspace: %w", err)
+	}
+	workspace := Workspace{Path: path}
+
+	defer func() {
+		panicValue := recover()
+		failed := panicValue != nil || (err != nil && ctx.Err() == nil)
+		m.release(workspace, failed)
+		if panicValue != nil {
+			panic(panicValue)
+		}
+	}()
+	return run(workspace)
+}
+
+// release removes the workspace or moves it into the quarantine directory if
+// the run failed and a quarantine directory is configured
+func (m *Manager) release(workspace Workspace, failed bool) {
+	if failed && m.QuarantineDirectory != "" {
+		err := m.quarantine(workspace)
+		if err == nil {
+			return
+		}
+		m.Logger.Warn().Err(err).Str("workspace", workspace.Path).Msg("unable to quarantine workspace")
+	}
+
+	err := os.RemoveAll(workspace.Path)
+	if err != nil {
+		m.Logger.Error().Err(err).Str("workspace", workspace.Path).Msg("unable to remove workspace")
+	}
+}
+
+// quarantine moves the workspace into the quarantine directory
+func (m *Manager) quarantine(workspace Workspace) error {
+	err := os.MkdirAll(m.QuarantineDirectory, 0o700)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(m.QuarantineDirectory, filepath.Base(workspace.Path))
+	err = os.Rename(workspace.Path, target)
+	if err != nil {
+		return fmt.Errorf("unable to move workspace into quarantine: %w", err)
+	}
+	m.Logger.Info().Str("workspace", target).Msg("moved workspace of failed run into quarantine")
+	return nil
+}
@@ -0,0 +1,117 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// errRunFailed is returned by the runs which fail on purpose
+var errRunFailed = errors.New("run failed")
+
+// entries returns the names of the entries of the directory. A missing
+// directory has no entries
+func entries(t *testing.T, directory string) []string {
+	t.Helper()
+	dirEntries, err := os.ReadDir(directory)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range dirEntries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestRunRemovesWorkspace(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(workspace Workspace) error
+	}{
+		{"successful run", func(Workspace) error { return nil }},
+		{"failed run", func(Workspace) error { return errRunFailed }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manager := &Manager{Root: filepath.Join(t.TempDir(), "workspaces"), Logger: zerolog.Nop()}
+			var path string
+			err := manager.Run(context.Background(), func(workspace Workspace) error {
+				path = workspace.Path
+				if err := os.WriteFile(workspace.File("request.json"), []byte("{}"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				return test.run(workspace)
+			})
+			if _, statErr := os.Stat(path); !errors.Is(statErr, os.ErrNotExist) {
+				t.Errorf("workspace %s still exists after the run returned %v", path, err)
+			}
+			if names := entries(t, manager.Root); len(names) != 0 {
+				t.Errorf("workspace root contains %v", names)
+			}
+		})
+	}
+}
+
+func TestRunRemovesWorkspaceAfterPanic(t *testing.T) {
+	manager := &Manager{Root: t.TempDir(), Logger: zerolog.Nop()}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("panic of the run has been swallowed")
+		}
+		if names := entries(t, manager.Root); len(names) != 0 {
+			t.Errorf("workspace root contains %v after a panic", names)
+		}
+	}()
+	_ = manager.Run(context.Background(), func(Workspace) error {
+		panic("run panicked")
+	})
+}
+
+func TestRunQuarantinesFailedWorkspace(t *testing.T) {
+	root := t.TempDir()
+	manager := &Manager{
+		Root:                filepath.Join(root, "workspaces"),
+		QuarantineDirectory: filepath.Join(root, "quarantine"),
+		Logger:              zerolog.Nop(),
+	}
+
+	err := manager.Run(context.Background(), func(workspace Workspace) error {
+		if err := os.WriteFile(workspace.File("stderr.log"), []byte("error"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return errRunFailed
+	})
+	if !errors.Is(err, errRunFailed) {
+		t.Fatalf("got error %v, want %v", err, errRunFailed)
+	}
+	if names := entries(t, manager.Root); len(names) != 0 {
+		t.Errorf("workspace root contains %v", names)
+	}
+	quarantined := entries(t, manager.QuarantineDirectory)
+	if len(quarantined) != 1 {
+		t.Fatalf("quarantine contains %v, want a single workspace", quarantined)
+	}
+	if _, err := os.Stat(filepath.Join(manager.QuarantineDirectory, quarantined[0], "stderr.log")); err != nil {
+		t.Errorf("files of the failed run are missing from the quarantine: %v", err)
+	}
+
+	// successful and cancelled runs are not quarantined
+	_ = manager.Run(context.Background(), func(Workspace) error { return nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = manager.Run(ctx, func(Workspace) error { return ctx.Err() })
+	if names := entries(t, manager.QuarantineDirectory); len(names) != 1 {
+		t.Errorf("quarantine contains %v, want only the failed run", names)
+	}
+	if names := entries(t, manager.Root); len(names) != 0 {
+		t.Errorf("workspace root contains %v", names)
+	}
+}